@@ -3,21 +3,17 @@ package agent
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
-	"net/netip"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/SenseUnit/rgap/config"
 	"github.com/SenseUnit/rgap/protocol"
-	"github.com/SenseUnit/rgap/util"
-	"github.com/hashicorp/go-multierror"
 )
 
 type Agent struct {
-	cfg *config.AgentConfig
+	cfg    *config.AgentConfig
+	sender *Sender
 }
 
 func NewAgent(cfg *config.AgentConfig) *Agent {
@@ -27,6 +23,10 @@ func NewAgent(cfg *config.AgentConfig) *Agent {
 	if a.cfg.Dialer == nil {
 		a.cfg.Dialer = new(net.Dialer)
 	}
+	if a.cfg.Logger == nil {
+		a.cfg.Logger = slog.Default()
+	}
+	a.sender = NewSender(a.cfg.Dialer)
 	return a
 }
 
@@ -40,7 +40,7 @@ func (a *Agent) Run(ctx context.Context) error {
 		defer done()
 		err := a.singleRun(runCtx, t)
 		if err != nil {
-			log.Printf("run error: %v", err)
+			a.cfg.Logger.Error("run error", "err", err)
 		}
 	}
 
@@ -75,72 +75,5 @@ func (a *Agent) singleRun(ctx context.Context, t time.Time) error {
 	if err != nil {
 		return fmt.Errorf("can't marshal announcement %#v: %w", announcement, err)
 	}
-	var wg sync.WaitGroup
-	errors := make([]error, len(a.cfg.Destinations))
-	for i, dst := range a.cfg.Destinations {
-		wg.Add(1)
-		go func(i int, dst string) {
-			defer wg.Done()
-			errors[i] = a.sendSingle(ctx, msg, dst)
-		}(i, dst)
-	}
-	wg.Wait()
-	var resErr error
-	for _, err := range errors {
-		if err != nil {
-			resErr = multierror.Append(resErr, err)
-		}
-	}
-	return resErr
-}
-
-func (a *Agent) sendSingle(ctx context.Context, msg []byte, dst string) error {
-	dstAddr, iface, err := util.SplitAndResolveAddrSpec(dst)
-	if err != nil {
-		return fmt.Errorf("destination %s: interface resolving failed: %w", dst, err)
-	}
-
-	conn, err := a.dialInterfaceContext(ctx, "udp", dstAddr, iface)
-	if err != nil {
-		return fmt.Errorf("Agent.sendSingle dial failed: %w", err)
-	}
-	connCloseSignal := make(chan struct{})
-	defer close(connCloseSignal)
-	go func() {
-		select {
-		case <-connCloseSignal:
-			conn.Close()
-		case <-ctx.Done():
-			conn.Close()
-		}
-	}()
-	if _, err := conn.Write(msg); err != nil {
-		return fmt.Errorf("Agent.sendSingle send failed: %w", err)
-	}
-	return nil
-}
-
-func (a *Agent) dialInterfaceContext(ctx context.Context, network, addr string, iif *net.Interface) (net.Conn, error) {
-	if iif == nil {
-		return a.cfg.Dialer.DialContext(ctx, network, addr)
-	}
-
-	var hints []string
-	addrs, err := iif.Addrs()
-	if err != nil {
-		return nil, err
-	}
-	for _, addr := range addrs {
-		ipnet, ok := addr.(*net.IPNet)
-		if !ok {
-			return nil, fmt.Errorf("unexpected type returned as address interface: %T", addr)
-		}
-		netipAddr, ok := netip.AddrFromSlice(ipnet.IP)
-		if !ok {
-			return nil, fmt.Errorf("interface %v has invalid address %s", iif.Name, ipnet.IP)
-		}
-		hints = append(hints, netipAddr.Unmap().String())
-	}
-	boundDialer := util.NewBoundDialer(a.cfg.Dialer, strings.Join(hints, ","))
-	return boundDialer.DialContext(ctx, network, addr)
+	return a.sender.Send(ctx, msg, a.cfg.Destinations)
 }
@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/SenseUnit/rgap/iface"
+	"github.com/SenseUnit/rgap/util"
+	"github.com/hashicorp/go-multierror"
+)
+
+type Sender struct {
+	dialer     iface.Dialer
+	httpClient *http.Client
+}
+
+func NewSender(dialer iface.Dialer) *Sender {
+	if dialer == nil {
+		dialer = new(net.Dialer)
+	}
+	return &Sender{
+		dialer: dialer,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:             http.ProxyFromEnvironment,
+				DialContext:       dialer.DialContext,
+				ForceAttemptHTTP2: true,
+			},
+		},
+	}
+}
+
+func (s *Sender) Send(ctx context.Context, msg []byte, destinations []string) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(destinations))
+	for i, dst := range destinations {
+		wg.Add(1)
+		go func(i int, dst string) {
+			defer wg.Done()
+			errs[i] = s.SendSingle(ctx, msg, dst)
+		}(i, dst)
+	}
+	wg.Wait()
+	var resErr error
+	for _, err := range errs {
+		if err != nil {
+			resErr = multierror.Append(resErr, err)
+		}
+	}
+	return resErr
+}
+
+func (s *Sender) SendSingle(ctx context.Context, msg []byte, dst string) error {
+	if strings.HasPrefix(dst, "http://") || strings.HasPrefix(dst, "https://") {
+		return s.sendHTTP(ctx, msg, dst)
+	}
+	if path, ok := strings.CutPrefix(dst, "unix:"); ok {
+		return s.sendUnix(ctx, msg, path)
+	}
+
+	dstAddr, iface, err := util.SplitAndResolveAddrSpec(dst)
+	if err != nil {
+		return fmt.Errorf("destination %s: interface resolving failed: %w", dst, err)
+	}
+
+	conn, err := s.dialInterfaceContext(ctx, "udp", dstAddr, iface)
+	if err != nil {
+		return fmt.Errorf("Sender.SendSingle dial failed: %w", err)
+	}
+	return writeConn(ctx, conn, msg)
+}
+
+func (s *Sender) sendUnix(ctx context.Context, msg []byte, path string) error {
+	conn, err := s.dialer.DialContext(ctx, "unixgram", path)
+	if errors.Is(err, syscall.EPROTOTYPE) {
+		// socket is of stream type
+		conn, err = s.dialer.DialContext(ctx, "unix", path)
+	}
+	if err != nil {
+		return fmt.Errorf("Sender.sendUnix dial failed: %w", err)
+	}
+	return writeConn(ctx, conn, msg)
+}
+
+func writeConn(ctx context.Context, conn net.Conn, msg []byte) error {
+	connCloseSignal := make(chan struct{})
+	defer close(connCloseSignal)
+	go func() {
+		select {
+		case <-connCloseSignal:
+			conn.Close()
+		case <-ctx.Done():
+			conn.Close()
+		}
+	}()
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("send to %s failed: %w", conn.RemoteAddr(), err)
+	}
+	return nil
+}
+
+func (s *Sender) sendHTTP(ctx context.Context, msg []byte, dst string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dst, bytes.NewReader(msg))
+	if err != nil {
+		return fmt.Errorf("Sender.sendHTTP bad request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Sender.sendHTTP send failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Sender.sendHTTP: destination %s responded with status %s", dst, resp.Status)
+	}
+	return nil
+}
+
+func (s *Sender) dialInterfaceContext(ctx context.Context, network, addr string, iif *net.Interface) (net.Conn, error) {
+	if iif == nil {
+		return s.dialer.DialContext(ctx, network, addr)
+	}
+
+	var hints []string
+	addrs, err := iif.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type returned as address interface: %T", addr)
+		}
+		netipAddr, ok := netip.AddrFromSlice(ipnet.IP)
+		if !ok {
+			return nil, fmt.Errorf("interface %v has invalid address %s", iif.Name, ipnet.IP)
+		}
+		hints = append(hints, netipAddr.Unmap().String())
+	}
+	boundDialer := util.NewBoundDialer(s.dialer, strings.Join(hints, ","))
+	return boundDialer.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,393 @@
+// Package bench implements load generator simulating many agents.
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SenseUnit/rgap/agent"
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/listener"
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	defaultWorkers      = 16
+	defaultPollInterval = 100 * time.Millisecond
+	defaultSettle       = 2 * time.Second
+	sendTimeout         = 5 * time.Second
+	pacingInterval      = 10 * time.Millisecond
+	matchTolerance      = 2000 // µs
+)
+
+type benchAgent struct {
+	address  netip.Addr
+	group    uint64
+	sent     []int64 // timestamps of sent announcements, µs
+	observed []bool
+	joinedAt time.Time
+	// expiration reported by listener before sending started, µs. Agent
+	// left over from previous run has it set and is excluded from join
+	// statistics.
+	baseline int64
+}
+
+type Bench struct {
+	agents       []*benchAgent
+	key          psk.PSK
+	rate         float64
+	duration     time.Duration
+	workers      int
+	destinations []string
+	sender       *agent.Sender
+	cluster      *listener.Cluster
+	statePeer    string
+	pollInterval time.Duration
+	settle       time.Duration
+	logger       *slog.Logger
+
+	mu         sync.Mutex
+	firstSent  map[*benchAgent]time.Time
+	offsets    map[uint64]int64
+	sendErrors atomic.Int64
+}
+
+func NewBench(cfg *config.BenchConfig) (*Bench, error) {
+	if cfg.Agents <= 0 {
+		return nil, errors.New("number of agents must be positive")
+	}
+	if cfg.Groups <= 0 {
+		return nil, errors.New("number of groups must be positive")
+	}
+	if cfg.Rate <= 0 {
+		return nil, errors.New("rate must be positive")
+	}
+	if cfg.Duration <= 0 {
+		return nil, errors.New("duration must be positive")
+	}
+	if len(cfg.Destinations) == 0 {
+		return nil, errors.New("no destinations specified")
+	}
+	if !cfg.AddressBase.IsValid() {
+		return nil, errors.New("base address is not specified")
+	}
+	b := &Bench{
+		key:          cfg.Key,
+		rate:         cfg.Rate,
+		duration:     cfg.Duration,
+		workers:      cfg.Workers,
+		destinations: cfg.Destinations,
+		sender:       agent.NewSender(nil),
+		statePeer:    cfg.StatePeer,
+		pollInterval: cfg.PollInterval,
+		settle:       cfg.Settle,
+		logger:       cfg.Logger,
+		firstSent:    make(map[*benchAgent]time.Time),
+		offsets:      make(map[uint64]int64),
+	}
+	if b.workers <= 0 {
+		b.workers = defaultWorkers
+	}
+	if b.pollInterval <= 0 {
+		b.pollInterval = defaultPollInterval
+	}
+	if b.settle <= 0 {
+		b.settle = defaultSettle
+	}
+	if b.logger == nil {
+		b.logger = slog.Default()
+	}
+	addr := cfg.AddressBase
+	for i := 0; i < cfg.Agents; i++ {
+		if !addr.IsValid() {
+			return nil, errors.New("address space exhausted, use lower base address or less agents")
+		}
+		b.agents = append(b.agents, &benchAgent{
+			address: addr,
+			group:   cfg.GroupBase + uint64(i%cfg.Groups),
+		})
+		addr = addr.Next()
+	}
+	if cfg.StatePeer != "" {
+		if cfg.StatePSK == nil {
+			return nil, errors.New("state PSK is not specified")
+		}
+		cluster, err := listener.ClusterFromConfig(&config.ClusterConfig{
+			Peers: []util.ExpandableString{util.ExpandableString(cfg.StatePeer)},
+			PSK:   cfg.StatePSK,
+		}, nil, b.logger)
+		if err != nil {
+			return nil, fmt.Errorf("unable to construct state client: %w", err)
+		}
+		b.cluster = cluster
+	}
+	return b, nil
+}
+
+// Run sends announcements for configured duration and returns report.
+// Cancellation of ctx stops sending early, but report is still produced.
+func (b *Bench) Run(ctx context.Context) (*Report, error) {
+	if b.cluster != nil {
+		if err := b.snapshotBaseline(ctx); err != nil {
+			return nil, fmt.Errorf("listener state is not available: %w", err)
+		}
+	}
+
+	queue := make(chan []byte, b.workers*4)
+	var workersDone sync.WaitGroup
+	for i := 0; i < b.workers; i++ {
+		workersDone.Add(1)
+		go func() {
+			defer workersDone.Done()
+			for msg := range queue {
+				sendCtx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+				if err := b.sender.Send(sendCtx, msg, b.destinations); err != nil {
+					b.sendErrors.Add(1)
+					b.logger.Debug("send error", "err", err)
+				}
+				cancel()
+			}
+		}()
+	}
+
+	pollCtx, pollCancel := context.WithCancel(context.Background())
+	pollDone := make(chan struct{})
+	go func() {
+		defer close(pollDone)
+		if b.cluster == nil {
+			return
+		}
+		ticker := time.NewTicker(b.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pollCtx.Done():
+				return
+			case <-ticker.C:
+				if err := b.poll(pollCtx); err != nil && pollCtx.Err() == nil {
+					b.logger.Warn("listener state query failed", "err", err)
+				}
+			}
+		}
+	}()
+
+	b.logger.Info("benchmark started",
+		"agents", len(b.agents), "rate", b.rate, "duration", b.duration)
+	start := time.Now()
+	sent := b.pace(ctx, start, queue)
+	close(queue)
+	workersDone.Wait()
+	elapsed := time.Since(start)
+
+	if ctx.Err() == nil && b.cluster != nil {
+		b.logger.Info("sending finished, waiting for listener to settle", "settle", b.settle)
+		select {
+		case <-ctx.Done():
+		case <-time.After(b.settle):
+		}
+	}
+	pollCancel()
+	<-pollDone
+	if b.cluster != nil {
+		finalCtx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := b.poll(finalCtx); err != nil {
+			b.logger.Warn("listener state query failed", "err", err)
+		}
+	}
+	return b.report(sent, elapsed), nil
+}
+
+func (b *Bench) pace(ctx context.Context, start time.Time, queue chan<- []byte) int {
+	ticker := time.NewTicker(pacingInterval)
+	defer ticker.Stop()
+	sent := 0
+	for {
+		now := time.Now()
+		elapsed := now.Sub(start)
+		if elapsed >= b.duration {
+			return sent
+		}
+		for due := int(b.rate * elapsed.Seconds()); sent < due; sent++ {
+			msg, err := b.announce(b.agents[sent%len(b.agents)], now)
+			if err != nil {
+				b.logger.Error("can't build announcement", "err", err)
+				return sent
+			}
+			select {
+			case queue <- msg:
+			case <-ctx.Done():
+				return sent
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return sent
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Bench) announce(a *benchAgent, t time.Time) ([]byte, error) {
+	b.mu.Lock()
+	ts := t.UnixMicro()
+	// timestamps identify announcements, so they have to be unique
+	if n := len(a.sent); n > 0 && ts <= a.sent[n-1] {
+		ts = a.sent[n-1] + 1
+	}
+	a.sent = append(a.sent, ts)
+	a.observed = append(a.observed, false)
+	if _, ok := b.firstSent[a]; !ok {
+		b.firstSent[a] = t
+	}
+	b.mu.Unlock()
+
+	ann := protocol.Announcement{
+		Data: protocol.AnnouncementData{
+			Version:          protocol.V1,
+			RedundancyID:     a.group,
+			Timestamp:        ts,
+			AnnouncedAddress: a.address.As16(),
+		},
+	}
+	sig, err := ann.Data.CalculateSignature(b.key)
+	if err != nil {
+		return nil, err
+	}
+	ann.Signature = sig
+	return ann.MarshalBinary()
+}
+
+// snapshotBaseline remembers agent addresses which are already present in
+// listener state before any announcement is sent.
+func (b *Bench) snapshotBaseline(ctx context.Context) error {
+	state, err := b.cluster.Query(ctx, b.statePeer)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, a := range b.agents {
+		if expiresAt, ok := state[a.group].Members[a.address]; ok {
+			a.baseline = expiresAt.UnixMicro()
+		}
+	}
+	return nil
+}
+
+type sighting struct {
+	agent     *benchAgent
+	expiresAt int64
+}
+
+func (b *Bench) poll(ctx context.Context) error {
+	state, err := b.cluster.Query(ctx, b.statePeer)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sightings := make(map[uint64][]sighting)
+	for _, a := range b.agents {
+		expiresAt, ok := state[a.group].Members[a.address]
+		if !ok || len(a.sent) == 0 {
+			continue
+		}
+		if a.baseline != 0 {
+			if expiresAt.UnixMicro() == a.baseline {
+				// entry is not refreshed by this run yet
+				continue
+			}
+		} else if a.joinedAt.IsZero() {
+			a.joinedAt = now
+		}
+		sightings[a.group] = append(sightings[a.group], sighting{a, expiresAt.UnixMicro()})
+	}
+	for group, groupSightings := range sightings {
+		offset, ok := b.offsets[group]
+		if !ok {
+			offset, ok = guessOffset(groupSightings)
+			if !ok {
+				continue
+			}
+			b.offsets[group] = offset
+		}
+		for _, s := range groupSightings {
+			ts := s.expiresAt - offset
+			idx := sort.Search(len(s.agent.sent), func(i int) bool { return s.agent.sent[i] >= ts-matchTolerance })
+			if idx < len(s.agent.sent) && s.agent.sent[idx] <= ts+matchTolerance {
+				s.agent.observed[idx] = true
+			}
+		}
+	}
+	return nil
+}
+
+// guessOffset finds out difference between expiration time reported by
+// listener and announcement timestamp. It's roughly the same for all
+// members of group: expire of that group. Listener
+// computes expiration relative to its own clock readings, so offsets are
+// compared with millisecond precision.
+func guessOffset(sightings []sighting) (int64, bool) {
+	votes := make(map[int64]int)
+	for _, s := range sightings {
+		for _, ts := range s.agent.sent {
+			if d := s.expiresAt - ts; d >= 0 {
+				votes[(d+500)/1000*1000]++
+			}
+		}
+	}
+	var (
+		best      int64
+		bestVotes int
+	)
+	for d, n := range votes {
+		if n > bestVotes || n == bestVotes && d < best {
+			best, bestVotes = d, n
+		}
+	}
+	return best, bestVotes > 0
+}
+
+func (b *Bench) report(sent int, elapsed time.Duration) *Report {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := &Report{
+		Agents:         len(b.agents),
+		Sent:           sent,
+		SendErrors:     int(b.sendErrors.Load()),
+		Elapsed:        elapsed,
+		StateAvailable: b.cluster != nil,
+		PollInterval:   b.pollInterval,
+	}
+	if r.StateAvailable {
+		agentInterval := time.Duration(float64(len(b.agents)) / b.rate * float64(time.Second))
+		r.PollLimited = agentInterval < b.pollInterval
+		for _, a := range b.agents {
+			for _, observed := range a.observed {
+				if observed {
+					r.Observed++
+				}
+			}
+			if a.baseline != 0 {
+				r.Preexisting++
+			}
+			if !a.joinedAt.IsZero() {
+				r.Joined++
+				r.JoinLatencies = append(r.JoinLatencies, a.joinedAt.Sub(b.firstSent[a]))
+			}
+		}
+		sort.Slice(r.JoinLatencies, func(i, j int) bool { return r.JoinLatencies[i] < r.JoinLatencies[j] })
+	}
+	return r
+}
@@ -0,0 +1,196 @@
+package bench
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/listener"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+func testBench(t *testing.T, agents int, rate float64) *Bench {
+	t.Helper()
+	key := util.Must(psk.GeneratePSK())
+	b, err := NewBench(&config.BenchConfig{
+		Agents:       agents,
+		Groups:       1,
+		GroupBase:    1000,
+		AddressBase:  netip.MustParseAddr("10.0.0.1"),
+		Key:          key,
+		Rate:         rate,
+		Duration:     time.Second,
+		Destinations: []string{"127.0.0.1:8271"},
+		StatePeer:    "127.0.0.1:8271",
+		StatePSK:     &key,
+		PollInterval: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestReportPercentile(t *testing.T) {
+	r := &Report{}
+	if r.Percentile(50) != 0 {
+		t.Error("percentile of empty report is not zero")
+	}
+	for i := 1; i <= 101; i++ {
+		r.JoinLatencies = append(r.JoinLatencies, time.Duration(i)*time.Millisecond)
+	}
+	for p, expected := range map[float64]time.Duration{
+		0:   time.Millisecond,
+		50:  51 * time.Millisecond,
+		90:  91 * time.Millisecond,
+		99:  100 * time.Millisecond,
+		100: 101 * time.Millisecond,
+	} {
+		if actual := r.Percentile(p); actual != expected {
+			t.Errorf("p%v = %v, expected %v", p, actual, expected)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	b := testBench(t, 4, 100)
+	start := time.Now()
+	// each agent sent 4 announcements, 9 of them were observed
+	for i, a := range b.agents {
+		a.sent = []int64{1, 2, 3, 4}
+		a.observed = make([]bool, len(a.sent))
+		b.firstSent[a] = start
+		if i < 3 {
+			for j := 0; j < 4-i; j++ {
+				a.observed[j] = true
+			}
+			a.joinedAt = start.Add(time.Duration(3-i) * 100 * time.Millisecond)
+		}
+	}
+	r := b.report(16, 2*time.Second)
+	if r.Observed != 9 || r.Joined != 3 {
+		t.Fatalf("observed %d, joined %d, expected 9 and 3", r.Observed, r.Joined)
+	}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	for i, d := range r.JoinLatencies {
+		if d != expected[i] {
+			t.Fatalf("join latencies %v, expected %v", r.JoinLatencies, expected)
+		}
+	}
+	// 4 agents at 100 announcements per second announce every 40ms
+	if !r.PollLimited {
+		t.Error("poll interval longer than announce interval is not reported")
+	}
+	out := r.String()
+	for _, line := range []string{
+		"sent 16 announcements in 2s (8.0/s), send errors: 0",
+		"agents joined: 3/4",
+		"join latency: min=100ms p50=200ms p90=200ms p99=200ms max=300ms (poll interval 100ms)",
+		"announcements observed: 9/16 (loss 43.75%)",
+		"warning: agents announce more often than state is polled",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("report %q does not contain %q", out, line)
+		}
+	}
+
+	b.cluster = nil
+	out = b.report(16, 2*time.Second).String()
+	if !strings.Contains(out, "loss and join latency are unknown") || strings.Contains(out, "agents joined") {
+		t.Errorf("report without state %q", out)
+	}
+}
+
+func TestPollBaseline(t *testing.T) {
+	b := testBench(t, 2, 100)
+	g, err := listener.GroupFromConfig(&config.GroupConfig{
+		ID:             1000,
+		PSK:            &b.key,
+		Expire:         time.Minute,
+		ReadinessDelay: time.Hour,
+	}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop()
+	peer, err := listener.ClusterFromConfig(&config.ClusterConfig{
+		BindAddress: "127.0.0.1:0",
+		PSK:         &b.key,
+	}, map[uint64]*listener.Group{1000: g}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(peer)
+	defer srv.Close()
+	b.statePeer = srv.URL + "/sync"
+
+	// first agent is left over from previous run
+	leftover, fresh := b.agents[0], b.agents[1]
+	g.Merge(leftover.address, time.Now().Add(30*time.Second))
+	if err := b.snapshotBaseline(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, a := range b.agents {
+		if _, err := b.announce(a, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.Merge(fresh.address, time.UnixMicro(fresh.sent[0]).Add(time.Minute))
+	if err := b.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !leftover.joinedAt.IsZero() || leftover.observed[0] {
+		t.Error("member left over from previous run is counted as joined")
+	}
+	if fresh.joinedAt.IsZero() || !fresh.observed[0] {
+		t.Error("new member is not observed")
+	}
+
+	// refreshed entry of leftover agent is matched to announcement
+	g.Merge(leftover.address, time.UnixMicro(leftover.sent[0]).Add(time.Minute))
+	if err := b.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !leftover.joinedAt.IsZero() || !leftover.observed[0] {
+		t.Errorf("refreshed leftover member: joined at %v, observed %v", leftover.joinedAt, leftover.observed[0])
+	}
+
+	r := b.report(2, time.Second)
+	if r.Preexisting != 1 || r.Joined != 1 || r.Observed != 2 {
+		t.Errorf("preexisting %d, joined %d, observed %d, expected 1, 1 and 2", r.Preexisting, r.Joined, r.Observed)
+	}
+	out := r.String()
+	for _, line := range []string{"agents joined: 1/1", "agents present before start: 1"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("report %q does not contain %q", out, line)
+		}
+	}
+}
+
+func TestGuessOffset(t *testing.T) {
+	a := &benchAgent{sent: []int64{1_000_000, 2_000_000, 3_000_000}}
+	other := &benchAgent{sent: []int64{1_500_000, 2_500_000}}
+	// listener expiration is announcement timestamp plus 15s with clock
+	// reading jitter
+	offset, ok := guessOffset([]sighting{
+		{a, 3_000_000 + 15_000_300},
+		{other, 2_500_000 + 14_999_800},
+	})
+	if !ok || offset != 15_000_000 {
+		t.Errorf("offset %d (%v), expected 15000000", offset, ok)
+	}
+	if _, ok := guessOffset([]sighting{{a, 0}}); ok {
+		t.Error("offset guessed from expiration preceding all announcements")
+	}
+}
@@ -0,0 +1,62 @@
+package bench
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Report struct {
+	Agents         int
+	Sent           int
+	SendErrors     int
+	Elapsed        time.Duration
+	StateAvailable bool
+	PollInterval   time.Duration
+	PollLimited    bool
+	Preexisting    int // agents present in listener state before start
+	Joined         int
+	JoinLatencies  []time.Duration // sorted
+	Observed       int
+}
+
+func (r *Report) Percentile(p float64) time.Duration {
+	if len(r.JoinLatencies) == 0 {
+		return 0
+	}
+	idx := int(p / 100 * float64(len(r.JoinLatencies)-1))
+	return r.JoinLatencies[idx]
+}
+
+func (r *Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "sent %d announcements in %v (%.1f/s), send errors: %d\n",
+		r.Sent, r.Elapsed.Round(time.Millisecond), float64(r.Sent)/r.Elapsed.Seconds(), r.SendErrors)
+	if !r.StateAvailable {
+		sb.WriteString("listener state is not queried, loss and join latency are unknown\n")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "agents joined: %d/%d\n", r.Joined, r.Agents-r.Preexisting)
+	if r.Preexisting > 0 {
+		fmt.Fprintf(&sb, "agents present before start: %d, excluded from join statistics\n", r.Preexisting)
+	}
+	if len(r.JoinLatencies) > 0 {
+		fmt.Fprintf(&sb, "join latency: min=%v p50=%v p90=%v p99=%v max=%v (poll interval %v)\n",
+			r.JoinLatencies[0].Round(time.Millisecond),
+			r.Percentile(50).Round(time.Millisecond),
+			r.Percentile(90).Round(time.Millisecond),
+			r.Percentile(99).Round(time.Millisecond),
+			r.JoinLatencies[len(r.JoinLatencies)-1].Round(time.Millisecond),
+			r.PollInterval,
+		)
+	}
+	loss := 0.
+	if r.Sent > 0 {
+		loss = 100 * float64(r.Sent-r.Observed) / float64(r.Sent)
+	}
+	fmt.Fprintf(&sb, "announcements observed: %d/%d (loss %.2f%%)\n", r.Observed, r.Sent, loss)
+	if r.PollLimited {
+		sb.WriteString("warning: agents announce more often than state is polled, loss is overestimated\n")
+	}
+	return sb.String()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"net/netip"
 	"os"
 	"time"
@@ -22,6 +23,7 @@ var (
 	group        uint64
 	address      addressOption
 	key          pskOption
+	keyFile      string
 	interval     time.Duration
 	destinations []string
 )
@@ -88,6 +90,13 @@ var agentCmd = &cobra.Command{
 				return err
 			}
 		}
+		if keyFile != "" {
+			fileKey, err := psk.LoadFile(keyFile)
+			if err != nil {
+				return err
+			}
+			key.psk = &fileKey
+		}
 		if key.psk == nil {
 			hexpsk, ok := os.LookupEnv(envPSK)
 			if !ok {
@@ -103,6 +112,7 @@ var agentCmd = &cobra.Command{
 			Key:          *key.psk,
 			Interval:     interval,
 			Destinations: destinations,
+			Logger:       slog.Default().With("component", "agent", "group", group),
 		}
 		return agent.NewAgent(cfg).Run(cmd.Context())
 	},
@@ -123,6 +133,8 @@ func init() {
 	agentCmd.Flags().Uint64VarP(&group, "group", "g", 0, "redundancy group")
 	agentCmd.Flags().VarP(&address, "address", "a", "IP address to announce")
 	agentCmd.Flags().VarP(&key, "psk", "k", "pre-shared key for announcement signature")
+	agentCmd.Flags().StringVar(&keyFile, "psk-file", "", "file to read hex-encoded pre-shared key from")
+	agentCmd.MarkFlagsMutuallyExclusive("psk", "psk-file")
 	agentCmd.Flags().DurationVarP(&interval, "interval", "i", 0, "announcement interval. If not specified agent sends one announce and exits")
 	agentCmd.Flags().StringArrayVarP(&destinations, "dst", "d", []string{"239.82.71.65:8271"}, "announcement destination address:port. Can be specified multiple times")
 }
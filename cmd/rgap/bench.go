@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SenseUnit/rgap/bench"
+	"github.com/SenseUnit/rgap/config"
+)
+
+var (
+	benchAgents       int
+	benchGroups       int
+	benchGroupBase    uint64
+	benchAddressBase  addressOption
+	benchKey          pskOption
+	benchRate         float64
+	benchDuration     time.Duration
+	benchWorkers      int
+	benchDestinations []string
+	benchStatePeer    string
+	benchStateKey     pskOption
+	benchPollInterval time.Duration
+	benchSettle       time.Duration
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Simulates many agents to measure listener performance",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if benchKey.psk == nil {
+			hexpsk, ok := os.LookupEnv(envPSK)
+			if !ok {
+				return fmt.Errorf("PSK is not specified neither in command line argument nor in %s environment variable", envPSK)
+			}
+			if err := benchKey.Set(hexpsk); err != nil {
+				return err
+			}
+		}
+		b, err := bench.NewBench(&config.BenchConfig{
+			Agents:       benchAgents,
+			Groups:       benchGroups,
+			GroupBase:    benchGroupBase,
+			AddressBase:  *benchAddressBase.addr,
+			Key:          *benchKey.psk,
+			Rate:         benchRate,
+			Duration:     benchDuration,
+			Workers:      benchWorkers,
+			Destinations: benchDestinations,
+			StatePeer:    benchStatePeer,
+			StatePSK:     benchStateKey.psk,
+			PollInterval: benchPollInterval,
+			Settle:       benchSettle,
+			Logger:       slog.Default().With("component", "bench"),
+		})
+		if err != nil {
+			return fmt.Errorf("can't initialize benchmark: %w", err)
+		}
+		report, err := b.Run(cmd.Context())
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(cmd.OutOrStdout(), report.String())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchAddressBase.Set("10.0.0.1")
+	benchCmd.Flags().IntVarP(&benchAgents, "agents", "n", 1000, "number of simulated agents")
+	benchCmd.Flags().IntVarP(&benchGroups, "groups", "m", 1, "number of groups agents are spread across")
+	benchCmd.Flags().Uint64VarP(&benchGroupBase, "group", "g", 1000, "first group ID. Groups are numbered sequentially starting from this ID")
+	benchCmd.Flags().Var(&benchAddressBase, "address-base", "address of first agent. Agents get sequential addresses starting from this one")
+	benchCmd.Flags().VarP(&benchKey, "psk", "k", "pre-shared key of groups")
+	benchCmd.Flags().Float64VarP(&benchRate, "rate", "r", 1000, "total announcements per second")
+	benchCmd.Flags().DurationVarP(&benchDuration, "duration", "t", 30*time.Second, "duration of benchmark")
+	benchCmd.Flags().IntVar(&benchWorkers, "workers", 16, "number of concurrent senders")
+	benchCmd.Flags().StringArrayVarP(&benchDestinations, "dst", "d", []string{"239.82.71.65:8271"}, "announcement destination, same as for agent. Can be specified multiple times")
+	benchCmd.Flags().StringVarP(&benchStatePeer, "state", "s", "", "cluster sync address or URL of listener to query its state from. Loss and join latency are reported only if specified")
+	benchCmd.Flags().Var(&benchStateKey, "state-psk", "cluster PSK of listener")
+	benchCmd.Flags().DurationVar(&benchPollInterval, "poll-interval", 100*time.Millisecond, "listener state query interval")
+	benchCmd.Flags().DurationVar(&benchSettle, "settle", 2*time.Second, "time to wait for in-flight announcements after sending is finished")
+}
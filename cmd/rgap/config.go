@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/listener"
+	"github.com/SenseUnit/rgap/output"
+	"github.com/SenseUnit/rgap/schema"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configuration file utilities",
+}
+
+// configSchemaCmd represents the config schema command
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Prints JSON Schema of listener configuration file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		g := schema.NewGenerator()
+		g.Override(reflect.TypeOf(config.SourceConfig{}), g.Kinds(listener.SourceSpecs()))
+		g.Override(reflect.TypeOf(config.OutputConfig{}), g.Kinds(output.OutputSpecs()))
+		doc := g.Document(reflect.TypeOf(config.ListenerConfig{}), "rgap listener configuration")
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configSchemaCmd)
+}
@@ -1,10 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
-	"github.com/SenseUnit/rgap/psk"
 	"github.com/spf13/cobra"
+
+	"github.com/SenseUnit/rgap/psk"
+)
+
+var (
+	genpskKDF            string
+	genpskSalt           string
+	genpskPassphraseFile string
+	genpskPassphraseEnv  string
+	genpskOutput         string
 )
 
 // genpskCmd represents the genpsk command
@@ -12,25 +26,67 @@ var genpskCmd = &cobra.Command{
 	Use:   "genpsk",
 	Short: "Generate and output hex-encoded pre-shared key",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		psk, err := psk.GeneratePSK()
-		if err != nil {
-			return fmt.Errorf("PSK generation failed: %w", err)
+		var (
+			key psk.PSK
+			err error
+		)
+		if genpskSalt != "" {
+			passphrase, err := readPassphrase()
+			if err != nil {
+				return err
+			}
+			key, err = psk.DerivePSK(genpskKDF, passphrase, []byte(genpskSalt))
+			if err != nil {
+				return fmt.Errorf("PSK derivation failed: %w", err)
+			}
+		} else {
+			if cmd.Flags().Changed("passphrase-file") || genpskPassphraseEnv != "" {
+				return errors.New("salt must be specified to derive PSK from passphrase")
+			}
+			key, err = psk.GeneratePSK()
+			if err != nil {
+				return fmt.Errorf("PSK generation failed: %w", err)
+			}
+		}
+		if genpskOutput != "" {
+			return psk.WriteFile(genpskOutput, key)
 		}
-		fmt.Println(psk.String())
+		fmt.Println(key.String())
 		return nil
 	},
 }
 
+func readPassphrase() ([]byte, error) {
+	if genpskPassphraseEnv != "" {
+		passphrase, ok := os.LookupEnv(genpskPassphraseEnv)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %q is not set", genpskPassphraseEnv)
+		}
+		return []byte(passphrase), nil
+	}
+	var r io.Reader = os.Stdin
+	if genpskPassphraseFile != "-" {
+		f, err := os.Open(genpskPassphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open passphrase file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	// only first line is used, so passphrase can be piped with echo
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to read passphrase: %w", err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
 func init() {
 	rootCmd.AddCommand(genpskCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// genpskCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// genpskCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	genpskCmd.Flags().StringVar(&genpskKDF, "kdf", psk.KDFScrypt, "key derivation function for passphrase: "+psk.KDFScrypt+" or "+psk.KDFArgon2id)
+	genpskCmd.Flags().StringVar(&genpskSalt, "salt", "", "salt for key derivation. If specified, PSK is derived from passphrase instead of being random")
+	genpskCmd.Flags().StringVar(&genpskPassphraseFile, "passphrase-file", "-", "file to read passphrase from. \"-\" stands for stdin")
+	genpskCmd.Flags().StringVar(&genpskPassphraseEnv, "passphrase-env", "", "environment variable to read passphrase from instead of file")
+	genpskCmd.Flags().StringVarP(&genpskOutput, "output", "o", "", "write PSK into file with 0600 permissions instead of stdout")
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SenseUnit/rgap/inspect"
+	"github.com/SenseUnit/rgap/listener"
+	"github.com/SenseUnit/rgap/psk"
+)
+
+var (
+	inspectListen string
+	inspectHex    string
+	inspectPcap   string
+	inspectKeys   []string
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Decodes and prints announcements for troubleshooting",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys := make([]psk.PSK, 0, len(inspectKeys))
+		for _, hexKey := range inspectKeys {
+			var key psk.PSK
+			if err := key.FromHexString(hexKey); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		inspector := inspect.NewInspector(cmd.OutOrStdout(), keys)
+
+		switch {
+		case inspectListen != "":
+			src := listener.NewRawUDPSource(inspectListen, inspectListen,
+				func(label, sender string, payload []byte) {
+					inspector.InspectRaw(time.Now(), label, sender, payload)
+				},
+				slog.Default(),
+			)
+			if err := src.Start(); err != nil {
+				return err
+			}
+			<-cmd.Context().Done()
+			return src.Stop()
+		case inspectHex != "":
+			r, err := openInput(inspectHex)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return inspect.ReadHex(r, func(lineNo int, payload []byte, err error) error {
+				sender := fmt.Sprintf("line:%d", lineNo)
+				if err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: %s: %v\n", inspectHex, sender, err)
+					return nil
+				}
+				inspector.InspectRaw(time.Now(), inspectHex, sender, payload)
+				return nil
+			})
+		default:
+			r, err := openInput(inspectPcap)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return inspect.ReadPcap(r, func(pkt *inspect.Packet) error {
+				inspector.InspectRaw(pkt.Time, inspectPcap, pkt.Sender, pkt.Payload)
+				return nil
+			})
+		}
+	},
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open input: %w", err)
+	}
+	return f, nil
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().StringVarP(&inspectListen, "listen", "l", "", "listen for announcements on UDP address spec, same as in listener configuration")
+	inspectCmd.Flags().StringVar(&inspectHex, "hex", "", "read hex-encoded packets, one per line, from file. Use \"-\" for stdin")
+	inspectCmd.Flags().StringVar(&inspectPcap, "pcap", "", "read UDP packets from pcap capture file. Use \"-\" for stdin")
+	inspectCmd.Flags().StringArrayVarP(&inspectKeys, "psk", "k", nil, "hex-encoded PSK to verify signatures with. Can be specified multiple times")
+	inspectCmd.MarkFlagsMutuallyExclusive("listen", "hex", "pcap")
+	inspectCmd.MarkFlagsOneRequired("listen", "hex", "pcap")
+}
@@ -2,10 +2,9 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"log/slog"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 
 	"github.com/SenseUnit/rgap/config"
 	"github.com/SenseUnit/rgap/listener"
@@ -20,18 +19,11 @@ var listenerCmd = &cobra.Command{
 	Use:   "listener",
 	Short: "Starts listener accepting and processing announcements",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var cfg config.ListenerConfig
-		cfgF, err := os.Open(configPath)
+		cfg, err := config.LoadListenerConfig(configPath)
 		if err != nil {
-			return fmt.Errorf("unable to read configuration file: %w", err)
+			return err
 		}
-		defer cfgF.Close()
-		dec := yaml.NewDecoder(cfgF)
-		dec.KnownFields(true)
-		if err := dec.Decode(&cfg); err != nil {
-			return fmt.Errorf("unable to decode configuration file: %w", err)
-		}
-		listener, err := listener.NewListener(&cfg)
+		listener, err := listener.NewListener(cfg, slog.Default())
 		if err != nil {
 			return fmt.Errorf("can't initialize listener: %w", err)
 		}
@@ -51,5 +43,5 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// listenerCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-	listenerCmd.Flags().StringVarP(&configPath, "config", "c", "rgap.yaml", "configuration file")
+	listenerCmd.Flags().StringVarP(&configPath, "config", "c", "rgap.yaml", "configuration file or directory")
 }
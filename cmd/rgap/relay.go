@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/relay"
+)
+
+var (
+	relayConfigPath string
+)
+
+// relayCmd represents the relay command
+var relayCmd = &cobra.Command{
+	Use:   "relay",
+	Short: "Forwards announcements between network segments",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var cfg config.RelayConfig
+		if err := config.Load(relayConfigPath, &cfg); err != nil {
+			return err
+		}
+		r, err := relay.NewRelay(&cfg, slog.Default().With("component", "relay"))
+		if err != nil {
+			return fmt.Errorf("can't initialize relay: %w", err)
+		}
+		return r.Run(cmd.Context())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(relayCmd)
+
+	relayCmd.Flags().StringVarP(&relayConfigPath, "config", "c", "relay.yaml", "configuration file")
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
@@ -17,6 +19,8 @@ const (
 
 var (
 	logPrefix logPrefixValue = newLogPrefixValue(defaultLogPrefix())
+	logFormat string
+	logLevel  logLevelValue
 )
 
 type logPrefixValue struct {
@@ -45,6 +49,62 @@ func (v *logPrefixValue) Set(s string) error {
 	return nil
 }
 
+type logLevelValue struct {
+	level slog.Level
+}
+
+func (v *logLevelValue) String() string {
+	return v.level.String()
+}
+
+func (v *logLevelValue) Type() string {
+	return "level"
+}
+
+func (v *logLevelValue) Set(s string) error {
+	return v.level.UnmarshalText([]byte(s))
+}
+
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+}
+
+func (pw prefixWriter) Write(p []byte) (int, error) {
+	// handler emits each record with a single write
+	buf := make([]byte, 0, len(pw.prefix)+len(p))
+	buf = append(buf, pw.prefix...)
+	buf = append(buf, p...)
+	if _, err := pw.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func setupLogging() error {
+	handler, err := newLogHandler(os.Stderr)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func newLogHandler(w io.Writer) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{
+		Level:     logLevel.level,
+		AddSource: logLevel.level <= slog.LevelDebug,
+	}
+	switch logFormat {
+	case "text":
+		return slog.NewTextHandler(prefixWriter{prefix: logPrefix.String(), w: w}, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", logFormat)
+	}
+}
+
 func defaultLogPrefix() string {
 	if envLogPrefixValue, ok := os.LookupEnv(envLogPrefix); ok {
 		return envLogPrefixValue
@@ -58,6 +118,9 @@ var rootCmd = &cobra.Command{
 	Short:        "Redundancy Group Announcement Protocol",
 	Long:         `See https://gist.github.com/Snawoot/39282757e5f7db40632e5e01280b683f for more details.`,
 	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupLogging()
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -68,8 +131,6 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	ctx, done := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer done()
-	log.Default().SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
-	log.Default().SetPrefix(logPrefix.String())
 	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
@@ -81,7 +142,9 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().Var(&logPrefix, "log-prefix", "log prefix")
+	rootCmd.PersistentFlags().Var(&logPrefix, "log-prefix", "log prefix. Applies to text log format only")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log format: text or json")
+	rootCmd.PersistentFlags().Var(&logLevel, "log-level", "log level: debug, info, warn or error")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
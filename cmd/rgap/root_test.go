@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func testLogSettings(t *testing.T, format, level, prefix string) {
+	t.Helper()
+	savedFormat, savedLevel, savedPrefix := logFormat, logLevel, logPrefix
+	t.Cleanup(func() {
+		logFormat, logLevel, logPrefix = savedFormat, savedLevel, savedPrefix
+	})
+	logFormat = format
+	if err := logLevel.Set(level); err != nil {
+		t.Fatal(err)
+	}
+	logPrefix = newLogPrefixValue(prefix)
+}
+
+func TestLogLevelValue(t *testing.T) {
+	for s, expected := range map[string]slog.Level{
+		"debug":  slog.LevelDebug,
+		"INFO":   slog.LevelInfo,
+		"warn":   slog.LevelWarn,
+		"error":  slog.LevelError,
+		"warn+2": slog.LevelWarn + 2,
+	} {
+		var v logLevelValue
+		if err := v.Set(s); err != nil {
+			t.Errorf("level %q: %v", s, err)
+			continue
+		}
+		if v.level != expected {
+			t.Errorf("level %q parsed as %v, expected %v", s, v.level, expected)
+		}
+	}
+	var v logLevelValue
+	if err := v.Set("verbose"); err == nil {
+		t.Error("unknown level accepted")
+	}
+}
+
+func TestTextLogHandler(t *testing.T) {
+	testLogSettings(t, "text", "info", "RGAP: ")
+	var buf bytes.Buffer
+	handler, err := newLogHandler(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(handler)
+	logger.Debug("hidden")
+	logger.Info("first", "group", 1000)
+	logger.Warn("second")
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %q, expected two records", buf.String())
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "RGAP: time=") {
+			t.Errorf("record %q is not prefixed", line)
+		}
+		if strings.Contains(line, "source=") {
+			t.Errorf("record %q has source above debug level", line)
+		}
+	}
+	if !strings.Contains(lines[0], "level=INFO msg=first group=1000") {
+		t.Errorf("unexpected record %q", lines[0])
+	}
+}
+
+func TestJSONLogHandler(t *testing.T) {
+	testLogSettings(t, "json", "debug", "RGAP: ")
+	var buf bytes.Buffer
+	handler, err := newLogHandler(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.New(handler).Debug("record", "group", 1000)
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("record %q is not prefix-free JSON: %v", buf.String(), err)
+	}
+	if record["level"] != "DEBUG" || record["msg"] != "record" || record["group"] != float64(1000) {
+		t.Errorf("unexpected record %v", record)
+	}
+	if _, ok := record[slog.SourceKey]; !ok {
+		t.Error("debug level record has no source")
+	}
+}
+
+func TestUnknownLogFormat(t *testing.T) {
+	testLogSettings(t, "xml", "info", "")
+	if _, err := newLogHandler(new(bytes.Buffer)); err == nil {
+		t.Error("unknown log format accepted")
+	}
+}
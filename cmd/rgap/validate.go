@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/listener"
+)
+
+var (
+	validateConfigPath string
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks listener configuration without starting listener",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadListenerConfig(validateConfigPath)
+		if err != nil {
+			return err
+		}
+		l, err := listener.NewListener(cfg, slog.Default())
+		if err != nil {
+			return fmt.Errorf("configuration is invalid: %w", err)
+		}
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("configuration is invalid: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: configuration is valid\n", validateConfigPath)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().StringVarP(&validateConfigPath, "config", "c", "rgap.yaml", "configuration file or directory")
+}
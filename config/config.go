@@ -1,6 +1,7 @@
 package config
 
 import (
+	"log/slog"
 	"net/netip"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 
 	"github.com/SenseUnit/rgap/iface"
 	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
 )
 
 type AgentConfig struct {
@@ -17,6 +19,7 @@ type AgentConfig struct {
 	Interval     time.Duration
 	Destinations []string
 	Dialer       iface.Dialer
+	Logger       *slog.Logger
 }
 
 type GroupConfig struct {
@@ -25,15 +28,68 @@ type GroupConfig struct {
 	Expire         time.Duration
 	ClockSkew      time.Duration `yaml:"clock_skew"`
 	ReadinessDelay time.Duration `yaml:"readiness_delay"`
+	MinMembers     int           `yaml:"min_members"`
+	ReadyWhen      int           `yaml:"ready_when_members_reach"`
+	JoinAfter      int           `yaml:"join_after"`
+	LeaveGrace     time.Duration `yaml:"leave_grace"`
+	Pos            Position      `yaml:"-"`
 }
 
 type OutputConfig struct {
 	Kind string
 	Spec yaml.Node
+	Pos  Position `yaml:"-"`
+}
+
+type SourceConfig struct {
+	Kind string
+	Spec yaml.Node
+	Pos  Position `yaml:"-"`
+}
+
+type ClusterConfig struct {
+	BindAddress util.ExpandableString `yaml:"bind_address"`
+	Peers       []util.ExpandableString
+	PSK         *psk.PSK
+	Interval    time.Duration
+	Timeout     time.Duration
+	ClockSkew   time.Duration `yaml:"clock_skew"`
+	Pos         Position      `yaml:"-"`
 }
 
 type ListenerConfig struct {
-	Listen  []string
-	Groups  []GroupConfig
-	Outputs []OutputConfig
+	Include   []string
+	Listen    []util.ExpandableString
+	ListenPos []Position `yaml:"-"`
+	Sources   []SourceConfig
+	Groups    []GroupConfig
+	Outputs   []OutputConfig
+	Cluster   *ClusterConfig
+}
+
+type RelayConfig struct {
+	Listen       []util.ExpandableString
+	ListenPos    []Position `yaml:"-"`
+	Sources      []SourceConfig
+	Destinations []util.ExpandableString
+	Groups       []uint64      `yaml:"only_groups"`
+	DedupWindow  time.Duration `yaml:"dedup_window"`
+	Timeout      time.Duration
+}
+
+type BenchConfig struct {
+	Agents       int
+	Groups       int
+	GroupBase    uint64
+	AddressBase  netip.Addr
+	Key          psk.PSK
+	Rate         float64
+	Duration     time.Duration
+	Workers      int
+	Destinations []string
+	StatePeer    string
+	StatePSK     *psk.PSK
+	PollInterval time.Duration
+	Settle       time.Duration
+	Logger       *slog.Logger
 }
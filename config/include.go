@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LoadListenerConfig loads listener configuration from file or from all
+// *.yaml and *.yml files of directory, following include directives.
+func LoadListenerConfig(path string) (*ListenerConfig, error) {
+	res := new(ListenerConfig)
+	l := &listenerConfigLoader{
+		dst:     res,
+		visited: make(map[string]struct{}),
+	}
+	if err := l.loadPath(path); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type listenerConfigLoader struct {
+	dst     *ListenerConfig
+	visited map[string]struct{}
+}
+
+func (l *listenerConfigLoader) loadPath(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unable to read configuration: %w", err)
+	}
+	if !fi.IsDir() {
+		return l.loadFile(path)
+	}
+	files, err := configDirFiles(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := l.loadFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *listenerConfigLoader) loadFile(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("unable to resolve configuration file path %s: %w", path, err)
+	}
+	if _, seen := l.visited[absPath]; seen {
+		// included more than once or include cycle
+		return nil
+	}
+	l.visited[absPath] = struct{}{}
+
+	var cfg ListenerConfig
+	if err := Load(path, &cfg); err != nil {
+		return err
+	}
+	if err := l.merge(&cfg); err != nil {
+		return err
+	}
+	for _, pattern := range cfg.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: bad include pattern %q: %w", path, pattern, err)
+		}
+		if len(matches) == 0 && !hasGlobMeta(pattern) {
+			return fmt.Errorf("%s: included file %s does not exist", path, pattern)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if err := l.loadPath(match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *listenerConfigLoader) merge(cfg *ListenerConfig) error {
+	l.dst.Include = append(l.dst.Include, cfg.Include...)
+	listenPos := make([]Position, len(cfg.Listen))
+	copy(listenPos, cfg.ListenPos)
+	l.dst.Listen = append(l.dst.Listen, cfg.Listen...)
+	l.dst.ListenPos = append(l.dst.ListenPos, listenPos...)
+	l.dst.Sources = append(l.dst.Sources, cfg.Sources...)
+	l.dst.Groups = append(l.dst.Groups, cfg.Groups...)
+	l.dst.Outputs = append(l.dst.Outputs, cfg.Outputs...)
+	if cfg.Cluster != nil {
+		if l.dst.Cluster != nil {
+			return cfg.Cluster.Pos.Errorf("cluster is already configured at %s", l.dst.Cluster.Pos)
+		}
+		l.dst.Cluster = cfg.Cluster
+	}
+	return nil
+}
+
+func configDirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration directory: %w", err)
+	}
+	var res []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		switch filepath.Ext(name) {
+		case ".yaml", ".yml":
+			res = append(res, filepath.Join(dir, name))
+		}
+	}
+	// ReadDir returns entries sorted by filename
+	return res, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+const testPSK = "8ba0c4a6f5b4c6c9fa7ef7d0e2c5e4b1a3f6d8e9c0b1a2d3e4f5a6b7c8d9e0f1"
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func group(id string) string {
+	return "  - id: " + id + "\n    psk: " + testPSK + "\n    expire: 15s\n"
+}
+
+func TestLoadListenerConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.yaml": "include:\n  - conf.d\n  - extra.yaml\nlisten:\n  - 127.0.0.1:8271\ngroups:\n" + group("1"),
+		// directory files are merged in lexical order
+		"conf.d/b.yaml": "groups:\n" + group("3"),
+		"conf.d/a.yml":  "\n\ngroups:\n" + group("2") + group("1"),
+		// hidden and foreign files are skipped
+		"conf.d/.hidden.yaml": "groups:\n" + group("100"),
+		"conf.d/notes.txt":    "groups: [",
+		// include cycle is followed once
+		"extra.yaml": "include: [main.yaml]\nlisten:\n  - 127.0.0.1:8272\ncluster:\n  bind_address: 127.0.0.1:8273\n  psk: " + testPSK + "\n",
+	})
+	cfg, err := LoadListenerConfig(filepath.Join(dir, "main.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		id   uint64
+		file string
+		line int
+	}{
+		{1, "main.yaml", 7},
+		{2, "conf.d/a.yml", 4},
+		{1, "conf.d/a.yml", 7},
+		{3, "conf.d/b.yaml", 2},
+	}
+	if len(cfg.Groups) != len(expected) {
+		t.Fatalf("loaded %d groups, expected %d", len(cfg.Groups), len(expected))
+	}
+	for i, e := range expected {
+		g := cfg.Groups[i]
+		if g.ID != e.id || g.Pos.File != filepath.Join(dir, e.file) || g.Pos.Line != e.line {
+			t.Errorf("group %d: id %d at %s, expected id %d at %s: line %d", i, g.ID, g.Pos, e.id, e.file, e.line)
+		}
+	}
+	// duplicate group definitions can be told apart by position
+	if !strings.HasSuffix(cfg.Groups[2].Pos.String(), filepath.Join("conf.d", "a.yml")+": line 7") {
+		t.Errorf("duplicate group position %q", cfg.Groups[2].Pos)
+	}
+
+	if strings.Join(util.PlainStrings(cfg.Listen), ",") != "127.0.0.1:8271,127.0.0.1:8272" {
+		t.Errorf("listen addresses %v", cfg.Listen)
+	}
+	if len(cfg.ListenPos) != 2 || cfg.ListenPos[1].File != filepath.Join(dir, "extra.yaml") || cfg.ListenPos[1].Line != 3 {
+		t.Errorf("listen positions %v", cfg.ListenPos)
+	}
+	if cfg.Cluster == nil || cfg.Cluster.Pos.File != filepath.Join(dir, "extra.yaml") {
+		t.Errorf("cluster %+v is not merged", cfg.Cluster)
+	}
+}
+
+func TestLoadListenerConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"10-groups.yaml": "groups:\n" + group("1"),
+		"00-listen.yaml": "listen: [127.0.0.1:8271]\n",
+	})
+	cfg, err := LoadListenerConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Listen) != 1 || len(cfg.Groups) != 1 || cfg.Groups[0].Pos.File != filepath.Join(dir, "10-groups.yaml") {
+		t.Errorf("unexpected configuration %+v", cfg)
+	}
+}
+
+func TestLoadListenerConfigErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		files map[string]string
+		err   string
+	}{
+		"missing include": {
+			map[string]string{"main.yaml": "include: [missing.yaml]\n"},
+			"missing.yaml does not exist",
+		},
+		"duplicate cluster": {
+			map[string]string{
+				"main.yaml":  "include: [other.yaml]\ncluster:\n  bind_address: 127.0.0.1:8273\n  psk: " + testPSK + "\n",
+				"other.yaml": "\ncluster:\n  bind_address: 127.0.0.1:8274\n  psk: " + testPSK + "\n",
+			},
+			"other.yaml: line 3: cluster is already configured at ",
+		},
+		"bad included file": {
+			map[string]string{
+				"main.yaml":       "include: ['conf.d/*.yaml']\n",
+				"conf.d/bad.yaml": "groups:\n  - id: 1\n    unknown: 1\n",
+			},
+			"bad.yaml",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tc.files)
+			_, err := LoadListenerConfig(filepath.Join(dir, "main.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("error %v, expected one containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestLoadListenerConfigReferences(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.yaml": "listen:\n  - ${RGAP_TEST_LISTEN}\ncluster:\n  peers: [\"$${literal}\"]\n  psk: ${RGAP_TEST_PSK}\n",
+	})
+	path := filepath.Join(dir, "main.yaml")
+	load := func(t *testing.T, missing string) *ListenerConfig {
+		t.Helper()
+		cfg, err := LoadListenerConfig(path)
+		if missing == "" {
+			if err != nil {
+				t.Fatal(err)
+			}
+			return cfg
+		}
+		if err == nil {
+			t.Fatalf("configuration with unset %s loaded", missing)
+		}
+		if !strings.Contains(err.Error(), `"`+missing+`"`) || !strings.Contains(err.Error(), path) {
+			t.Errorf("error %q doesn't name variable %s and file", err, missing)
+		}
+		return nil
+	}
+
+	t.Setenv("RGAP_TEST_LISTEN", "127.0.0.1:8271")
+	t.Setenv("RGAP_TEST_PSK", testPSK)
+	cfg := load(t, "")
+	if listen := util.PlainStrings(cfg.Listen); len(listen) != 1 || listen[0] != "127.0.0.1:8271" {
+		t.Errorf("unexpected listen addresses %v", listen)
+	}
+	if peers := util.PlainStrings(cfg.Cluster.Peers); len(peers) != 1 || peers[0] != "${literal}" {
+		t.Errorf("unexpected peers %v", peers)
+	}
+
+	// every load resolves references against current environment
+	os.Unsetenv("RGAP_TEST_PSK")
+	load(t, "RGAP_TEST_PSK")
+	t.Setenv("RGAP_TEST_PSK", testPSK)
+	os.Unsetenv("RGAP_TEST_LISTEN")
+	load(t, "RGAP_TEST_LISTEN")
+	t.Setenv("RGAP_TEST_LISTEN", "127.0.0.1:8272")
+	if listen := util.PlainStrings(load(t, "").Listen); len(listen) != 1 || listen[0] != "127.0.0.1:8272" {
+		t.Errorf("reloaded listen addresses %v", listen)
+	}
+}
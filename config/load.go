@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Position is a location of configuration element in configuration file.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	switch {
+	case p.Line == 0 && p.File == "":
+		return "unknown position"
+	case p.Line == 0:
+		return p.File
+	case p.File == "":
+		return fmt.Sprintf("line %d", p.Line)
+	default:
+		return fmt.Sprintf("%s: line %d", p.File, p.Line)
+	}
+}
+
+// Errorf is like fmt.Errorf, but prefixes message with position if it's known.
+func (p Position) Errorf(format string, a ...interface{}) error {
+	if p.Line == 0 && p.File == "" {
+		return fmt.Errorf(format, a...)
+	}
+	return fmt.Errorf("%s: "+format, append([]interface{}{p}, a...)...)
+}
+
+type positioner interface {
+	setPositions(doc *yaml.Node, file string)
+}
+
+// Load strictly decodes YAML configuration file into dst.
+func Load(path string, dst interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read configuration file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(dst); err != nil {
+		if errors.Is(err, io.EOF) {
+			// file is empty or has only comments
+			return nil
+		}
+		return fmt.Errorf("unable to decode configuration file %s: %w", path, err)
+	}
+	if p, ok := dst.(positioner); ok {
+		// strict decoding is not available for nodes, so positions
+		// are recovered from separately parsed node tree
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err == nil && len(root.Content) > 0 {
+			p.setPositions(root.Content[0], path)
+		}
+	}
+	return nil
+}
+
+func lookupKey(doc *yaml.Node, key string) *yaml.Node {
+	if doc.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == key {
+			return doc.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func seqPositions(doc *yaml.Node, key, file string) []Position {
+	seq := lookupKey(doc, key)
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		return nil
+	}
+	res := make([]Position, 0, len(seq.Content))
+	for _, item := range seq.Content {
+		res = append(res, Position{File: file, Line: item.Line, Column: item.Column})
+	}
+	return res
+}
+
+func (c *ListenerConfig) setPositions(doc *yaml.Node, file string) {
+	c.ListenPos = seqPositions(doc, "listen", file)
+	for i, pos := range seqPositions(doc, "sources", file) {
+		if i < len(c.Sources) {
+			c.Sources[i].Pos = pos
+		}
+	}
+	for i, pos := range seqPositions(doc, "groups", file) {
+		if i < len(c.Groups) {
+			c.Groups[i].Pos = pos
+		}
+	}
+	for i, pos := range seqPositions(doc, "outputs", file) {
+		if i < len(c.Outputs) {
+			c.Outputs[i].Pos = pos
+		}
+	}
+	if node := lookupKey(doc, "cluster"); node != nil && c.Cluster != nil {
+		c.Cluster.Pos = Position{File: file, Line: node.Line, Column: node.Column}
+	}
+}
+
+func (c *RelayConfig) setPositions(doc *yaml.Node, file string) {
+	c.ListenPos = seqPositions(doc, "listen", file)
+	for i, pos := range seqPositions(doc, "sources", file) {
+		if i < len(c.Sources) {
+			c.Sources[i].Pos = pos
+		}
+	}
+}
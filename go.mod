@@ -1,6 +1,7 @@
 module github.com/SenseUnit/rgap
 
-go 1.21.4
+go 1.23.0
+
 toolchain go1.24.1
 
 require (
@@ -9,6 +10,7 @@ require (
 	github.com/miekg/dns v1.1.58
 	github.com/natefinch/atomic v1.0.1
 	github.com/spf13/cobra v1.8.0
+	golang.org/x/crypto v0.36.0
 	golang.org/x/exp v0.0.0-20240119083558-1b970713d09a
 	gopkg.in/yaml.v3 v3.0.1
 	pgregory.net/rand v1.0.2
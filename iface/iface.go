@@ -13,21 +13,49 @@ type Dialer interface {
 
 type GroupEventCallback = func(group uint64, item GroupItem)
 
+type RejectionCallback = func(rejection Rejection)
+
+const (
+	RejectUnknownGroup       = "unknown group"
+	RejectUnsupportedVersion = "unsupported version"
+	RejectClockSkew          = "clock skew"
+	RejectBadSignature       = "bad signature"
+)
+
 type GroupBridge interface {
 	Groups() []uint64
 	ListGroup(uint64) []GroupItem
 	GroupReady(uint64) bool
+	GroupDegraded(uint64) bool
 	GroupReadinessBarrier(uint64) <-chan struct{}
 	OnJoin(uint64, GroupEventCallback) func()
 	OnLeave(uint64, GroupEventCallback) func()
+	OnReject(RejectionCallback) func()
 }
 
 type GroupItem interface {
 	Address() netip.Addr
 	ExpiresAt() time.Time
+	Flaps() uint64
+}
+
+type Rejection interface {
+	Time() time.Time
+	Source() string
+	Sender() string
+	Group() uint64
+	Address() netip.Addr
+	Reason() string
+	Drift() time.Duration
 }
 
 type StartStopper interface {
 	Start() error
 	Stop() error
 }
+
+// Validator is implemented by components which can check their
+// configuration against environment without acquiring any resources.
+type Validator interface {
+	Validate() error
+}
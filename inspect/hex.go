@@ -0,0 +1,42 @@
+package inspect
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReadHex reads hex-encoded packets, one per line, and calls fn for every
+// packet. Whitespace and colons within line are ignored, empty lines and
+// lines starting with # are skipped.
+func ReadHex(r io.Reader, fn func(lineNo int, payload []byte, err error) error) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.Map(func(r rune) rune {
+			switch r {
+			case ' ', '\t', ':':
+				return -1
+			}
+			return r
+		}, line)
+		payload, err := hex.DecodeString(line)
+		if err != nil {
+			err = fmt.Errorf("bad hex string: %w", err)
+		}
+		if err := fn(lineNo, payload, err); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read hex input: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Package inspect decodes announcements from various inputs for
+// troubleshooting purposes.
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/psk"
+)
+
+type Inspector struct {
+	keys []psk.PSK
+	out  io.Writer
+	mu   sync.Mutex
+}
+
+// NewInspector returns Inspector which writes reports into out and checks
+// announcement signatures against given keys.
+func NewInspector(out io.Writer, keys []psk.PSK) *Inspector {
+	return &Inspector{
+		keys: keys,
+		out:  out,
+	}
+}
+
+// InspectRaw decodes payload of datagram received at time t and reports it.
+// Payloads which are not announcements are reported as rejected.
+func (i *Inspector) InspectRaw(t time.Time, source, sender string, payload []byte) {
+	if len(payload) != protocol.AnnouncementSize {
+		i.reportRejected(t, source, sender, len(payload), fmt.Sprintf("unexpected payload size, expected %d", protocol.AnnouncementSize))
+		return
+	}
+	ann := new(protocol.Announcement)
+	if err := ann.UnmarshalBinary(payload); err != nil {
+		i.reportRejected(t, source, sender, len(payload), err.Error())
+		return
+	}
+	i.Inspect(t, source, sender, ann)
+}
+
+// Inspect reports decoded announcement received at time t.
+func (i *Inspector) Inspect(t time.Time, source, sender string, ann *protocol.Announcement) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "version=0x%04x", ann.Data.Version)
+	if ann.Data.Version != protocol.V1 {
+		sb.WriteString("(unsupported)")
+	}
+	announceTime := time.UnixMicro(ann.Data.Timestamp)
+	fmt.Fprintf(&sb, " group=%d address=%s timestamp=%s drift=%v signature=%s",
+		ann.Data.RedundancyID,
+		netip.AddrFrom16(ann.Data.AnnouncedAddress).Unmap(),
+		announceTime.UTC().Format(time.RFC3339Nano),
+		t.Sub(announceTime),
+		i.checkSignature(ann),
+	)
+	i.report(t, source, sender, sb.String())
+}
+
+func (i *Inspector) checkSignature(ann *protocol.Announcement) string {
+	if len(i.keys) == 0 {
+		return "unchecked"
+	}
+	for idx, key := range i.keys {
+		if ok, err := ann.CheckSignature(key); err == nil && ok {
+			if len(i.keys) == 1 {
+				return "valid"
+			}
+			return fmt.Sprintf("valid(key#%d)", idx+1)
+		}
+	}
+	return "INVALID"
+}
+
+func (i *Inspector) reportRejected(t time.Time, source, sender string, size int, reason string) {
+	i.report(t, source, sender, fmt.Sprintf("rejected=true size=%d error=%q", size, reason))
+}
+
+func (i *Inspector) report(t time.Time, source, sender, details string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	fmt.Fprintf(i.out, "time=%s source=%s sender=%s %s\n",
+		t.UTC().Format(time.RFC3339Nano), source, sender, details)
+}
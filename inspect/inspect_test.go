@@ -0,0 +1,47 @@
+package inspect
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+func TestInspectRaw(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	now := time.Now()
+	ann := &protocol.Announcement{
+		Data: protocol.AnnouncementData{
+			Version:          protocol.V1,
+			RedundancyID:     1000,
+			Timestamp:        now.UnixMicro(),
+			AnnouncedAddress: netip.MustParseAddr("10.0.0.1").As16(),
+		},
+	}
+	ann.Signature = util.Must(ann.Data.CalculateSignature(key))
+	payload := util.Must(ann.MarshalBinary())
+
+	var out bytes.Buffer
+	inspector := NewInspector(&out, []psk.PSK{key})
+	for _, tc := range []struct {
+		payload  []byte
+		expected []string
+	}{
+		{payload, []string{"sender=192.0.2.1:40000", "group=1000", "address=10.0.0.1", "signature=valid"}},
+		{payload[:10], []string{"sender=192.0.2.1:40000", "rejected=true", "size=10", "unexpected payload size"}},
+		{nil, []string{"sender=192.0.2.1:40000", "rejected=true", "size=0"}},
+	} {
+		out.Reset()
+		inspector.InspectRaw(now, "udp", "192.0.2.1:40000", tc.payload)
+		for _, s := range tc.expected {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("report %q doesn't contain %q", out.String(), s)
+			}
+		}
+	}
+}
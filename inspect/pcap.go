@@ -0,0 +1,190 @@
+package inspect
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+const (
+	pcapMagicMicros   = 0xa1b2c3d4
+	pcapMagicNanos    = 0xa1b23c4d
+	pcapMaxRecordSize = 256 * 1024
+
+	linkTypeNull      = 0
+	linkTypeEthernet  = 1
+	linkTypeRaw       = 101
+	linkTypeLinuxSLL  = 113
+	linkTypeIPv4      = 228
+	linkTypeIPv6      = 229
+	linkTypeLinuxSLL2 = 276
+
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+
+	ipProtoUDP = 17
+)
+
+// Packet is a UDP datagram extracted from capture.
+type Packet struct {
+	Time    time.Time
+	Sender  string
+	Payload []byte
+}
+
+// ReadPcap reads capture file in classic libpcap format and calls fn for
+// every UDP datagram found in it. Packets of other protocols, fragments
+// and packets of unsupported link types are skipped.
+func ReadPcap(r io.Reader, fn func(*Packet) error) error {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return fmt.Errorf("unable to read pcap header: %w", err)
+	}
+	var (
+		order binary.ByteOrder
+		nanos bool
+	)
+	for _, o := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch o.Uint32(hdr[0:4]) {
+		case pcapMagicMicros:
+			order = o
+		case pcapMagicNanos:
+			order, nanos = o, true
+		}
+		if order != nil {
+			break
+		}
+	}
+	if order == nil {
+		return errors.New("not a pcap file (pcapng is not supported)")
+	}
+	linkType := order.Uint32(hdr[20:24]) & 0xffff
+
+	var recHdr [16]byte
+	for {
+		if _, err := io.ReadFull(r, recHdr[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("unable to read pcap record header: %w", err)
+		}
+		sec := int64(order.Uint32(recHdr[0:4]))
+		frac := int64(order.Uint32(recHdr[4:8]))
+		inclLen := order.Uint32(recHdr[8:12])
+		if inclLen > pcapMaxRecordSize {
+			return fmt.Errorf("pcap record is too large: %d bytes", inclLen)
+		}
+		data := make([]byte, inclLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("unable to read pcap record: %w", err)
+		}
+		if !nanos {
+			frac *= 1000
+		}
+		pkt, ok := udpPacket(linkType, data)
+		if !ok {
+			continue
+		}
+		pkt.Time = time.Unix(sec, frac)
+		if err := fn(pkt); err != nil {
+			return err
+		}
+	}
+}
+
+func udpPacket(linkType uint32, data []byte) (*Packet, bool) {
+	var etherType uint16
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(data) < 4 {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[16:]
+	case linkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[0:2])
+		data = data[20:]
+	case linkTypeNull, linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		if linkType == linkTypeNull {
+			if len(data) < 4 {
+				return nil, false
+			}
+			data = data[4:]
+		}
+		if len(data) < 1 {
+			return nil, false
+		}
+		switch data[0] >> 4 {
+		case 4:
+			etherType = etherTypeIPv4
+		case 6:
+			etherType = etherTypeIPv6
+		}
+	default:
+		return nil, false
+	}
+
+	var src netip.Addr
+	switch etherType {
+	case etherTypeIPv4:
+		if len(data) < 20 {
+			return nil, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		totalLen := int(binary.BigEndian.Uint16(data[2:4]))
+		fragOffset := binary.BigEndian.Uint16(data[6:8]) & 0x1fff
+		if data[9] != ipProtoUDP || fragOffset != 0 || ihl < 20 || totalLen < ihl || len(data) < totalLen {
+			return nil, false
+		}
+		src = netip.AddrFrom4([4]byte(data[12:16]))
+		data = data[ihl:totalLen]
+	case etherTypeIPv6:
+		if len(data) < 40 {
+			return nil, false
+		}
+		payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+		if data[6] != ipProtoUDP || len(data) < 40+payloadLen {
+			return nil, false
+		}
+		src = netip.AddrFrom16([16]byte(data[8:24]))
+		data = data[40 : 40+payloadLen]
+	default:
+		return nil, false
+	}
+
+	if len(data) < 8 {
+		return nil, false
+	}
+	srcPort := binary.BigEndian.Uint16(data[0:2])
+	udpLen := int(binary.BigEndian.Uint16(data[4:6]))
+	if udpLen < 8 || len(data) < udpLen {
+		return nil, false
+	}
+	return &Packet{
+		Sender:  net.JoinHostPort(src.String(), strconv.Itoa(int(srcPort))),
+		Payload: data[8:udpLen],
+	}, true
+}
@@ -0,0 +1,72 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func buildPcap(t *testing.T, ts time.Time, payload []byte) []byte {
+	t.Helper()
+	udp := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(udp[0:2], 40000)
+	binary.BigEndian.PutUint16(udp[2:4], 8271)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+
+	ip := make([]byte, 20, 20+len(udp))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(udp)))
+	ip[8] = 64
+	ip[9] = ipProtoUDP
+	copy(ip[12:16], []byte{192, 0, 2, 1})
+	copy(ip[16:20], []byte{239, 82, 71, 65})
+	ip = append(ip, udp...)
+
+	frame := make([]byte, 14, 14+len(ip))
+	binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv4)
+	frame = append(frame, ip...)
+
+	var buf bytes.Buffer
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:4], pcapMagicMicros)
+	binary.LittleEndian.PutUint16(hdr[4:6], 2)
+	binary.LittleEndian.PutUint16(hdr[6:8], 4)
+	binary.LittleEndian.PutUint32(hdr[16:20], 65535)
+	binary.LittleEndian.PutUint32(hdr[20:24], linkTypeEthernet)
+	buf.Write(hdr)
+	rec := make([]byte, 16)
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:8], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:12], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(rec[12:16], uint32(len(frame)))
+	buf.Write(rec)
+	buf.Write(frame)
+	return buf.Bytes()
+}
+
+func TestReadPcap(t *testing.T) {
+	ts := time.Unix(1718000000, 123456000)
+	payload := []byte("announcement")
+	var pkts []*Packet
+	err := ReadPcap(bytes.NewReader(buildPcap(t, ts, payload)), func(pkt *Packet) error {
+		pkts = append(pkts, pkt)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkts) != 1 {
+		t.Fatalf("unexpected number of packets: %d != 1", len(pkts))
+	}
+	if !pkts[0].Time.Equal(ts) {
+		t.Errorf("unexpected packet time: %v != %v", pkts[0].Time, ts)
+	}
+	if pkts[0].Sender != "192.0.2.1:40000" {
+		t.Errorf("unexpected sender: %s", pkts[0].Sender)
+	}
+	if !bytes.Equal(pkts[0].Payload, payload) {
+		t.Errorf("unexpected payload: %q", pkts[0].Payload)
+	}
+}
@@ -0,0 +1,354 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	clusterSignaturePrefix  = "RGAP cluster"
+	clusterSignatureHeader  = "X-Rgap-Signature"
+	clusterSyncPath         = "/sync"
+	clusterMaxBodySize      = 64 << 20
+	defaultClusterInterval  = 10 * time.Second
+	defaultClusterTimeout   = 5 * time.Second
+	defaultClusterClockSkew = 10 * time.Second
+)
+
+type clusterEntry struct {
+	Address   netip.Addr `json:"address"`
+	ExpiresAt int64      `json:"expires_at"`
+}
+
+type clusterGroup struct {
+	Ready   bool           `json:"ready"`
+	Entries []clusterEntry `json:"entries"`
+}
+
+type clusterSnapshot struct {
+	Timestamp int64                   `json:"timestamp"`
+	Groups    map[uint64]clusterGroup `json:"groups"`
+	// Query marks read-only request: peer responds with its state, but
+	// doesn't merge anything from request.
+	Query bool `json:"query,omitempty"`
+}
+
+type Cluster struct {
+	bindAddress string
+	peers       []string
+	psk         psk.PSK
+	interval    time.Duration
+	timeout     time.Duration
+	clockSkew   time.Duration
+	groups      map[uint64]*Group
+	client      *http.Client
+	logger      *slog.Logger
+	server      *http.Server
+	serverDone  chan struct{}
+	ctx         context.Context
+	ctxCancel   func()
+	loopDone    chan struct{}
+}
+
+func ClusterFromConfig(cfg *config.ClusterConfig, groups map[uint64]*Group, logger *slog.Logger) (*Cluster, error) {
+	if cfg.PSK == nil {
+		return nil, errors.New("cluster PSK is not set")
+	}
+	if cfg.BindAddress == "" && len(cfg.Peers) == 0 {
+		return nil, errors.New("neither cluster bind address nor peers are specified")
+	}
+	c := &Cluster{
+		bindAddress: string(cfg.BindAddress),
+		psk:         *cfg.PSK,
+		interval:    cfg.Interval,
+		timeout:     cfg.Timeout,
+		clockSkew:   cfg.ClockSkew,
+		groups:      groups,
+		logger:      logger.With("component", "cluster"),
+	}
+	if c.interval <= 0 {
+		c.interval = defaultClusterInterval
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultClusterTimeout
+	}
+	if c.clockSkew <= 0 {
+		c.clockSkew = defaultClusterClockSkew
+	}
+	for _, peer := range util.PlainStrings(cfg.Peers) {
+		c.peers = append(c.peers, clusterPeerURL(peer))
+	}
+	c.client = &http.Client{
+		Timeout: c.timeout,
+	}
+	return c, nil
+}
+
+func (c *Cluster) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.ctx = ctx
+	c.ctxCancel = cancel
+	c.loopDone = make(chan struct{})
+
+	if c.bindAddress != "" {
+		ln, err := net.Listen("tcp", c.bindAddress)
+		if err != nil {
+			return fmt.Errorf("cluster listen failed: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle(clusterSyncPath, c)
+		c.server = &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: c.timeout,
+			ErrorLog:          slog.NewLogLogger(c.logger.Handler(), slog.LevelError),
+		}
+		c.serverDone = make(chan struct{})
+		go func() {
+			defer close(c.serverDone)
+			if err := c.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				c.logger.Error("HTTP server error", "err", err)
+			}
+		}()
+	}
+
+	// initial sync allows restarted node to catch up with peers
+	// before outputs are started
+	c.syncAll()
+	go c.loop()
+	c.logger.Info("started cluster node", "address", c.bindAddress, "peers", len(c.peers))
+	return nil
+}
+
+func (c *Cluster) Stop() error {
+	c.ctxCancel()
+	<-c.loopDone
+	if c.server != nil {
+		c.server.Close()
+		<-c.serverDone
+	}
+	c.logger.Info("stopped cluster node", "address", c.bindAddress)
+	return nil
+}
+
+func (c *Cluster) loop() {
+	defer close(c.loopDone)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.syncAll()
+		}
+	}
+}
+
+func (c *Cluster) syncAll() {
+	var wg sync.WaitGroup
+	for _, peer := range c.peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			if err := c.exchange(peer); err != nil {
+				c.logger.Warn("sync with peer failed", "peer", peer, "err", err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) exchange(peer string) error {
+	snap, err := c.roundTrip(c.ctx, peer, false)
+	if err != nil {
+		return err
+	}
+	c.merge(snap)
+	return nil
+}
+
+// PeerGroupState is a state of group reported by cluster peer.
+type PeerGroupState struct {
+	Ready bool
+	// Members maps member addresses to their expiration time
+	Members map[netip.Addr]time.Time
+}
+
+// Query fetches state of groups from peer without merging it into local
+// groups. Peer doesn't merge local state either. Peer may be specified in
+// the same formats as in configuration.
+func (c *Cluster) Query(ctx context.Context, peer string) (map[uint64]PeerGroupState, error) {
+	snap, err := c.roundTrip(ctx, clusterPeerURL(peer), true)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[uint64]PeerGroupState, len(snap.Groups))
+	for gid, cg := range snap.Groups {
+		state := PeerGroupState{
+			Ready:   cg.Ready,
+			Members: make(map[netip.Addr]time.Time, len(cg.Entries)),
+		}
+		for _, entry := range cg.Entries {
+			state.Members[entry.Address.Unmap()] = time.UnixMicro(entry.ExpiresAt)
+		}
+		res[gid] = state
+	}
+	return res, nil
+}
+
+func (c *Cluster) roundTrip(ctx context.Context, peer string, query bool) (*clusterSnapshot, error) {
+	body, err := c.encodeSnapshot(query)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("bad request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(clusterSignatureHeader, c.sign(body))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, clusterMaxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer responded with status %s", resp.Status)
+	}
+	return c.decodeSnapshot(respBody, resp.Header.Get(clusterSignatureHeader))
+}
+
+func clusterPeerURL(peer string) string {
+	if !strings.HasPrefix(peer, "http://") && !strings.HasPrefix(peer, "https://") {
+		return "http://" + peer + clusterSyncPath
+	}
+	return peer
+}
+
+func (c *Cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, clusterMaxBodySize))
+	if err != nil {
+		http.Error(w, "unable to read request body", http.StatusBadRequest)
+		return
+	}
+	snap, err := c.decodeSnapshot(body, r.Header.Get(clusterSignatureHeader))
+	if err != nil {
+		c.logger.Warn("rejected sync request", "remote", r.RemoteAddr, "err", err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !snap.Query {
+		c.merge(snap)
+	}
+	respBody, err := c.encodeSnapshot(false)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(clusterSignatureHeader, c.sign(respBody))
+	w.Write(respBody)
+}
+
+func (c *Cluster) sign(body []byte) string {
+	h := hmac.New(sha256.New, c.psk.AsSlice())
+	h.Write([]byte(clusterSignaturePrefix))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cluster) encodeSnapshot(query bool) ([]byte, error) {
+	groups := c.groups
+	if query {
+		// state of querying node is ignored by peer anyway
+		groups = nil
+	}
+	snap := clusterSnapshot{
+		Timestamp: time.Now().UnixMicro(),
+		Groups:    make(map[uint64]clusterGroup, len(groups)),
+		Query:     query,
+	}
+	for gid, g := range groups {
+		items := g.List()
+		cg := clusterGroup{
+			Ready:   g.Ready(),
+			Entries: make([]clusterEntry, 0, len(items)),
+		}
+		for _, item := range items {
+			cg.Entries = append(cg.Entries, clusterEntry{
+				Address:   item.Address(),
+				ExpiresAt: item.ExpiresAt().UnixMicro(),
+			})
+		}
+		snap.Groups[gid] = cg
+	}
+	body, err := json.Marshal(&snap)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode cluster snapshot: %w", err)
+	}
+	return body, nil
+}
+
+func (c *Cluster) decodeSnapshot(body []byte, signature string) (*clusterSnapshot, error) {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("bad signature encoding: %w", err)
+	}
+	expected, _ := hex.DecodeString(c.sign(body))
+	if !hmac.Equal(sig, expected) {
+		return nil, errors.New("signature mismatch")
+	}
+	var snap clusterSnapshot
+	if err := json.Unmarshal(body, &snap); err != nil {
+		return nil, fmt.Errorf("unable to decode cluster snapshot: %w", err)
+	}
+	if drift := time.Since(time.UnixMicro(snap.Timestamp)); drift.Abs() > c.clockSkew {
+		return nil, fmt.Errorf("snapshot timestamp drift %v exceeds allowed clock skew", drift)
+	}
+	return &snap, nil
+}
+
+func (c *Cluster) merge(snap *clusterSnapshot) {
+	for gid, cg := range snap.Groups {
+		g, ok := c.groups[gid]
+		if !ok {
+			continue
+		}
+		for _, entry := range cg.Entries {
+			g.Merge(entry.Address, time.UnixMicro(entry.ExpiresAt))
+		}
+		if cg.Ready && !g.Ready() {
+			c.logger.Info("group is ready on peer, marking it ready", "group", gid)
+			g.MarkReady()
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+func testGroup(t *testing.T, cfg config.GroupConfig) *Group {
+	t.Helper()
+	if cfg.ID == 0 {
+		cfg.ID = 1000
+	}
+	if cfg.PSK == nil {
+		key := util.Must(psk.GeneratePSK())
+		cfg.PSK = &key
+	}
+	if cfg.Expire == 0 {
+		cfg.Expire = time.Minute
+	}
+	if cfg.ReadinessDelay == 0 {
+		cfg.ReadinessDelay = time.Hour
+	}
+	g, err := GroupFromConfig(&cfg, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Stop() })
+	return g
+}
+
+func testCluster(t *testing.T, key psk.PSK, groups ...*Group) *Cluster {
+	t.Helper()
+	groupMap := make(map[uint64]*Group)
+	for _, g := range groups {
+		groupMap[g.ID()] = g
+	}
+	c, err := ClusterFromConfig(&config.ClusterConfig{
+		BindAddress: "127.0.0.1:0",
+		PSK:         &key,
+	}, groupMap, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ctx = context.Background()
+	return c
+}
+
+func expiries(g *Group) map[netip.Addr]time.Time {
+	res := make(map[netip.Addr]time.Time)
+	for _, item := range g.List() {
+		res[item.Address()] = item.ExpiresAt()
+	}
+	return res
+}
+
+func TestClusterRejectsBadSnapshots(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	g := testGroup(t, config.GroupConfig{})
+	c := testCluster(t, key, g)
+	other := testCluster(t, util.Must(psk.GeneratePSK()))
+
+	snapshot := func(ts time.Time) []byte {
+		return util.Must(json.Marshal(clusterSnapshot{
+			Timestamp: ts.UnixMicro(),
+			Groups: map[uint64]clusterGroup{
+				1000: {
+					Ready: true,
+					Entries: []clusterEntry{{
+						Address:   netip.MustParseAddr("10.0.0.1"),
+						ExpiresAt: time.Now().Add(time.Minute).UnixMicro(),
+					}},
+				},
+			},
+		}))
+	}
+	fresh := snapshot(time.Now())
+	for _, tc := range []struct {
+		name      string
+		body      []byte
+		signature string
+	}{
+		{"no signature", fresh, ""},
+		{"bad signature encoding", fresh, "zz"},
+		{"foreign key", fresh, other.sign(fresh)},
+		{"tampered body", bytes.Replace(fresh, []byte("10.0.0.1"), []byte("10.0.0.2"), 1), c.sign(fresh)},
+		{"stale snapshot", snapshot(time.Now().Add(-time.Hour)), c.sign(snapshot(time.Now().Add(-time.Hour)))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, clusterSyncPath, bytes.NewReader(tc.body))
+			req.Header.Set(clusterSignatureHeader, tc.signature)
+			rec := httptest.NewRecorder()
+			c.ServeHTTP(rec, req)
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("status %d, expected %d", rec.Code, http.StatusForbidden)
+			}
+			if len(g.List()) != 0 || g.Ready() {
+				t.Fatal("rejected snapshot was merged")
+			}
+		})
+	}
+}
+
+func TestClusterMerge(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	local := testGroup(t, config.GroupConfig{})
+	remote := testGroup(t, config.GroupConfig{})
+	localNode := testCluster(t, key, local)
+	remoteNode := testCluster(t, key, remote)
+	srv := httptest.NewServer(remoteNode)
+	defer srv.Close()
+
+	now := time.Now()
+	shared := netip.MustParseAddr("10.0.0.1")
+	localOnly := netip.MustParseAddr("10.0.0.2")
+	remoteOnly := netip.MustParseAddr("10.0.0.3")
+	local.Merge(shared, now.Add(10*time.Second))
+	local.Merge(localOnly, now.Add(20*time.Second))
+	remote.Merge(shared, now.Add(30*time.Second))
+	remote.Merge(remoteOnly, now.Add(40*time.Second))
+	remote.MarkReady()
+
+	if err := localNode.exchange(srv.URL + clusterSyncPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// both sides end up with union of members and the latest expiration
+	// of each member
+	expected := map[netip.Addr]time.Time{
+		shared:     now.Add(30 * time.Second),
+		localOnly:  now.Add(20 * time.Second),
+		remoteOnly: now.Add(40 * time.Second),
+	}
+	for name, g := range map[string]*Group{"local": local, "remote": remote} {
+		actual := expiries(g)
+		if len(actual) != len(expected) {
+			t.Fatalf("%s members %v, expected %v", name, actual, expected)
+		}
+		for addr, expiresAt := range expected {
+			if d := actual[addr].Sub(expiresAt).Abs(); d > 10*time.Millisecond {
+				t.Errorf("%s member %s expires at %v, expected %v", name, addr, actual[addr], expiresAt)
+			}
+		}
+	}
+	if !local.Ready() {
+		t.Error("group ready on peer is not marked ready locally")
+	}
+	if !remote.Ready() {
+		t.Error("remote group lost readiness")
+	}
+}
+
+func TestClusterQuery(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	local := testGroup(t, config.GroupConfig{})
+	remote := testGroup(t, config.GroupConfig{})
+	localNode := testCluster(t, key, local)
+	remoteNode := testCluster(t, key, remote)
+	srv := httptest.NewServer(remoteNode)
+	defer srv.Close()
+
+	now := time.Now()
+	localOnly := netip.MustParseAddr("10.0.0.1")
+	remoteOnly := netip.MustParseAddr("10.0.0.2")
+	local.Merge(localOnly, now.Add(10*time.Second))
+	local.MarkReady()
+	remote.Merge(remoteOnly, now.Add(20*time.Second))
+
+	state, err := localNode.Query(context.Background(), srv.URL+clusterSyncPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := state[1000].Members
+	if len(members) != 1 || members[remoteOnly].Sub(now.Add(20*time.Second)).Abs() > 10*time.Millisecond {
+		t.Errorf("unexpected peer state %v", members)
+	}
+	// query doesn't change state on either side
+	if _, ok := expiries(remote)[localOnly]; ok || remote.Ready() {
+		t.Error("query was merged by peer")
+	}
+	if _, ok := expiries(local)[remoteOnly]; ok {
+		t.Error("query response was merged locally")
+	}
+}
+
+func TestMergeCapsExpiration(t *testing.T) {
+	g := testGroup(t, config.GroupConfig{Expire: time.Minute, ClockSkew: 10 * time.Second})
+	addr := netip.MustParseAddr("10.0.0.1")
+	g.Merge(addr, time.Now().Add(24*time.Hour))
+	expiresAt, ok := expiries(g)[addr]
+	if !ok {
+		t.Fatal("address is not merged")
+	}
+	if limit := time.Now().Add(time.Minute + 10*time.Second); expiresAt.After(limit) {
+		t.Fatalf("merged expiration %v exceeds %v", expiresAt, limit)
+	}
+	g.Merge(netip.MustParseAddr("10.0.0.2"), time.Now().Add(-time.Second))
+	if len(g.List()) != 1 {
+		t.Fatal("expired address is merged")
+	}
+}
@@ -3,8 +3,9 @@ package listener
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/netip"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,21 +17,44 @@ import (
 	"github.com/jellydator/ttlcache/v3"
 )
 
+const (
+	mergeTolerance = time.Millisecond
+	// flap counter of address is reset after it stays out of group for
+	// this long
+	flapMemory = 1 * time.Hour
+)
+
 type Group struct {
 	id               uint64
 	psk              psk.PSK
 	expire           time.Duration
 	clockSkew        time.Duration
 	readinessDelay   time.Duration
+	minMembers       int
+	readyWhen        int
+	joinAfter        int
+	leaveGrace       time.Duration
 	addrSet          *ttlcache.Cache[netip.Addr, struct{}]
+	present          *ttlcache.Cache[netip.Addr, time.Time]
+	sightings        *ttlcache.Cache[netip.Addr, sighting]
+	joins            *ttlcache.Cache[netip.Addr, uint64]
+	mu               sync.Mutex
+	logger           *slog.Logger
 	ready            atomic.Bool
 	readinessBarrier chan struct{}
+	readinessOnce    sync.Once
 	readinessTimer   *time.Timer
 }
 
+type sighting struct {
+	count     int
+	timestamp int64
+}
+
 type groupItem struct {
 	address   netip.Addr
 	expiresAt time.Time
+	flaps     uint64
 }
 
 func (gi groupItem) Address() netip.Addr {
@@ -41,7 +65,11 @@ func (gi groupItem) ExpiresAt() time.Time {
 	return gi.expiresAt
 }
 
-func GroupFromConfig(cfg *config.GroupConfig) (*Group, error) {
+func (gi groupItem) Flaps() uint64 {
+	return gi.flaps
+}
+
+func GroupFromConfig(cfg *config.GroupConfig, logger *slog.Logger) (*Group, error) {
 	if cfg.PSK == nil {
 		return nil, fmt.Errorf("group %d: PSK is not set", cfg.ID)
 	}
@@ -54,10 +82,30 @@ func GroupFromConfig(cfg *config.GroupConfig) (*Group, error) {
 		expire:           cfg.Expire,
 		clockSkew:        cfg.ClockSkew,
 		readinessDelay:   cfg.ReadinessDelay,
+		minMembers:       cfg.MinMembers,
+		readyWhen:        cfg.ReadyWhen,
+		joinAfter:        cfg.JoinAfter,
+		leaveGrace:       cfg.LeaveGrace,
 		readinessBarrier: make(chan struct{}),
 		addrSet: ttlcache.New[netip.Addr, struct{}](
 			ttlcache.WithDisableTouchOnHit[netip.Addr, struct{}](),
 		),
+		present: ttlcache.New[netip.Addr, time.Time](
+			ttlcache.WithDisableTouchOnHit[netip.Addr, time.Time](),
+		),
+		sightings: ttlcache.New[netip.Addr, sighting](
+			ttlcache.WithDisableTouchOnHit[netip.Addr, sighting](),
+		),
+		joins: ttlcache.New[netip.Addr, uint64](
+			ttlcache.WithDisableTouchOnHit[netip.Addr, uint64](),
+		),
+		logger: logger.With("group", cfg.ID),
+	}
+	if g.minMembers < 0 || g.readyWhen < 0 || g.joinAfter < 0 {
+		return nil, fmt.Errorf("group %d: member count thresholds can't be negative", cfg.ID)
+	}
+	if g.leaveGrace < 0 {
+		return nil, fmt.Errorf("group %d: leave grace period can't be negative", cfg.ID)
 	}
 	if g.clockSkew <= 0 {
 		g.clockSkew = g.expire
@@ -76,32 +124,35 @@ func (g *Group) ID() uint64 {
 
 func (g *Group) Start() error {
 	go g.addrSet.Start()
-	g.readinessTimer = time.AfterFunc(g.readinessDelay, func() {
-		g.ready.Store(true)
-		close(g.readinessBarrier)
-	})
-	log.Printf("Group %d was started.", g.id)
+	go g.present.Start()
+	go g.sightings.Start()
+	go g.joins.Start()
+	g.readinessTimer = time.AfterFunc(g.readinessDelay, g.MarkReady)
+	g.logger.Info("group started")
 	return nil
 }
 
 func (g *Group) Stop() error {
 	g.addrSet.Stop()
+	g.present.Stop()
+	g.sightings.Stop()
+	g.joins.Stop()
 	if g.readinessTimer != nil {
 		g.readinessTimer.Stop()
 	}
-	log.Printf("Group %d was destroyed.", g.id)
+	g.logger.Info("group destroyed")
 	return nil
 }
 
 func (g *Group) Ingest(a *protocol.Announcement) error {
-	if a.Data.Version != protocol.V1 {
-		return nil
-	}
 	now := time.Now()
 	announceTime := time.UnixMicro(a.Data.Timestamp)
 	timeDrift := now.Sub(announceTime)
+	if a.Data.Version != protocol.V1 {
+		return &RejectError{Reason: iface.RejectUnsupportedVersion, Drift: timeDrift}
+	}
 	if timeDrift.Abs() > g.clockSkew {
-		return nil
+		return &RejectError{Reason: iface.RejectClockSkew, Drift: timeDrift}
 	}
 	ok, err := a.CheckSignature(g.psk)
 	if err != nil {
@@ -109,17 +160,86 @@ func (g *Group) Ingest(a *protocol.Announcement) error {
 		return fmt.Errorf("announce verification failed: %w", err)
 	}
 	if !ok {
-		return nil
+		return &RejectError{Reason: iface.RejectBadSignature, Drift: timeDrift}
 	}
 	address := netip.AddrFrom16(a.Data.AnnouncedAddress)
-	expireAt := announceTime.Add(g.expire)
-	setItem := g.addrSet.Get(address)
-	if setItem == nil || setItem.ExpiresAt().Before(expireAt) {
-		g.addrSet.Set(address, struct{}{}, util.Max(expireAt.Sub(now), 1))
+	if !g.sighted(address, a.Data.Timestamp) {
+		return nil
 	}
+	g.update(address, announceTime.Add(g.expire), now)
 	return nil
 }
 
+// sighted reports whether address was seen in enough distinct
+// announcements to be admitted into group.
+func (g *Group) sighted(address netip.Addr, timestamp int64) bool {
+	if g.joinAfter <= 1 || g.present.Has(address) {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := sighting{}
+	if item := g.sightings.Get(address); item != nil {
+		s = item.Value()
+	}
+	if timestamp > s.timestamp {
+		s.count++
+		s.timestamp = timestamp
+	}
+	if s.count >= g.joinAfter {
+		g.sightings.Delete(address)
+		return true
+	}
+	g.sightings.Set(address, s, g.expire)
+	return false
+}
+
+// Merge adds address learned from other source than announcement,
+// such as cluster peer. Entry is updated only if it extends expiration
+// noticeably, so peers do not keep bouncing rounded timestamps.
+// Expiration is capped by the latest one an announcement could produce.
+func (g *Group) Merge(address netip.Addr, expireAt time.Time) {
+	now := time.Now()
+	if !expireAt.After(now) {
+		return
+	}
+	if limit := now.Add(g.clockSkew + g.expire); expireAt.After(limit) {
+		expireAt = limit
+	}
+	if setItem := g.addrSet.Get(address); setItem != nil && setItem.ExpiresAt().Add(mergeTolerance).After(expireAt) {
+		return
+	}
+	g.update(address, expireAt, now)
+}
+
+func (g *Group) update(address netip.Addr, expireAt, now time.Time) {
+	g.mu.Lock()
+	if setItem := g.addrSet.Get(address); setItem == nil || setItem.ExpiresAt().Before(expireAt) {
+		g.addrSet.Set(address, struct{}{}, util.Max(expireAt.Sub(now), 1))
+	} else {
+		expireAt = setItem.ExpiresAt()
+	}
+	var joins uint64
+	if item := g.joins.Get(address); item != nil {
+		joins = item.Value()
+	}
+	if !g.present.Has(address) {
+		// counted before join event is emitted, so subscribers see it
+		joins++
+	}
+	// address stays present for leave grace period after expiration.
+	// Returning address is updated in place, so neither leave nor join
+	// event is emitted.
+	presentTTL := util.Max(expireAt.Add(g.leaveGrace).Sub(now), 1)
+	g.present.Set(address, expireAt, presentTTL)
+	g.joins.Set(address, joins, presentTTL+flapMemory)
+	g.mu.Unlock()
+	if g.readyWhen > 0 && !g.Ready() && g.addrSet.Len() >= g.readyWhen {
+		g.logger.Info("group has reached required number of members, marking it ready", "members", g.readyWhen)
+		g.MarkReady()
+	}
+}
+
 func (g *Group) List() []iface.GroupItem {
 	items := g.addrSet.Items()
 	res := make([]iface.GroupItem, 0, len(items))
@@ -130,33 +250,56 @@ func (g *Group) List() []iface.GroupItem {
 		res = append(res, groupItem{
 			address:   item.Key(),
 			expiresAt: item.ExpiresAt(),
+			flaps:     g.flaps(item.Key()),
 		})
 	}
 	return res
 }
 
+func (g *Group) flaps(address netip.Addr) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if item := g.joins.Get(address); item != nil && item.Value() > 1 {
+		return item.Value() - 1
+	}
+	return 0
+}
+
 func (g *Group) Ready() bool {
 	return g.ready.Load()
 }
 
+func (g *Group) Degraded() bool {
+	return g.minMembers > 0 && len(g.List()) < g.minMembers
+}
+
+func (g *Group) MarkReady() {
+	g.readinessOnce.Do(func() {
+		g.ready.Store(true)
+		close(g.readinessBarrier)
+	})
+}
+
 func (g *Group) ReadinessBarrier() <-chan struct{} {
 	return g.readinessBarrier
 }
 
 func (g *Group) OnJoin(cb iface.GroupEventCallback) func() {
-	return g.addrSet.OnInsertion(func(_ context.Context, item *ttlcache.Item[netip.Addr, struct{}]) {
+	return g.present.OnInsertion(func(_ context.Context, item *ttlcache.Item[netip.Addr, time.Time]) {
 		cb(g.id, groupItem{
 			address:   item.Key(),
-			expiresAt: item.ExpiresAt(),
+			expiresAt: item.Value(),
+			flaps:     g.flaps(item.Key()),
 		})
 	})
 }
 
 func (g *Group) OnLeave(cb iface.GroupEventCallback) func() {
-	return g.addrSet.OnEviction(func(_ context.Context, _ ttlcache.EvictionReason, item *ttlcache.Item[netip.Addr, struct{}]) {
+	return g.present.OnEviction(func(_ context.Context, _ ttlcache.EvictionReason, item *ttlcache.Item[netip.Addr, time.Time]) {
 		cb(g.id, groupItem{
 			address:   item.Key(),
-			expiresAt: item.ExpiresAt(),
+			expiresAt: item.Value(),
+			flaps:     g.flaps(item.Key()),
 		})
 	})
 }
@@ -0,0 +1,199 @@
+package listener
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/iface"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+func TestGroupMemberCountReadiness(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	g := testGroup(t, config.GroupConfig{
+		PSK:        &key,
+		MinMembers: 2,
+		ReadyWhen:  3,
+	})
+	addrs := []netip.Addr{
+		netip.MustParseAddr("10.0.0.1"),
+		netip.MustParseAddr("10.0.0.2"),
+		netip.MustParseAddr("10.0.0.3"),
+	}
+	for i, tc := range []struct {
+		ready    bool
+		degraded bool
+	}{
+		{false, true},
+		{false, false},
+		{true, false},
+	} {
+		if err := g.Ingest(testAnnouncement(key, 1000, addrs[i], time.Now())); err != nil {
+			t.Fatal(err)
+		}
+		if g.Ready() != tc.ready || g.Degraded() != tc.degraded {
+			t.Errorf("after %d members: ready=%v degraded=%v, expected ready=%v degraded=%v",
+				i+1, g.Ready(), g.Degraded(), tc.ready, tc.degraded)
+		}
+	}
+	select {
+	case <-g.ReadinessBarrier():
+	default:
+		t.Error("readiness barrier is not released")
+	}
+}
+
+func TestGroupConfigThresholds(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	for _, cfg := range []config.GroupConfig{
+		{ID: 1, PSK: &key, Expire: time.Minute, MinMembers: -1},
+		{ID: 1, PSK: &key, Expire: time.Minute, ReadyWhen: -1},
+		{ID: 1, PSK: &key, Expire: time.Minute, JoinAfter: -1},
+		{ID: 1, PSK: &key, Expire: time.Minute, LeaveGrace: -time.Second},
+	} {
+		if _, err := GroupFromConfig(&cfg, testLogger); err == nil {
+			t.Errorf("config %+v accepted", cfg)
+		}
+	}
+}
+
+type groupEvent struct {
+	join      bool
+	address   netip.Addr
+	expiresAt time.Time
+	flaps     uint64
+}
+
+func subscribe(g *Group) <-chan groupEvent {
+	ch := make(chan groupEvent, 16)
+	g.OnJoin(func(_ uint64, item iface.GroupItem) {
+		ch <- groupEvent{true, item.Address(), item.ExpiresAt(), item.Flaps()}
+	})
+	g.OnLeave(func(_ uint64, item iface.GroupItem) {
+		ch <- groupEvent{false, item.Address(), item.ExpiresAt(), item.Flaps()}
+	})
+	return ch
+}
+
+func expectEvent(t *testing.T, events <-chan groupEvent, join bool, flaps uint64, timeout time.Duration) groupEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		if ev.join != join || ev.flaps != flaps {
+			t.Fatalf("got event %+v, expected join=%v flaps=%d", ev, join, flaps)
+		}
+		return ev
+	case <-time.After(timeout):
+		t.Fatalf("no event within %v, expected join=%v", timeout, join)
+	}
+	return groupEvent{}
+}
+
+func expectNoEvent(t *testing.T, events <-chan groupEvent, timeout time.Duration) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(timeout):
+	}
+}
+
+func TestGroupJoinAfter(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	g := testGroup(t, config.GroupConfig{PSK: &key, JoinAfter: 3})
+	events := subscribe(g)
+	addr := netip.MustParseAddr("10.0.0.1")
+	ts := time.Now()
+	for i, step := range []struct {
+		ts      time.Time
+		members int
+	}{
+		{ts, 0},
+		// replayed announcement is not a distinct sighting
+		{ts, 0},
+		{ts.Add(time.Millisecond), 0},
+		{ts.Add(2 * time.Millisecond), 1},
+	} {
+		if err := g.Ingest(testAnnouncement(key, 1000, addr, step.ts)); err != nil {
+			t.Fatal(err)
+		}
+		if members := len(g.List()); members != step.members {
+			t.Fatalf("step %d: %d members, expected %d", i, members, step.members)
+		}
+	}
+	expectEvent(t, events, true, 0, time.Second)
+	expectNoEvent(t, events, 50*time.Millisecond)
+}
+
+func TestGroupLeaveGrace(t *testing.T) {
+	const (
+		expire = 200 * time.Millisecond
+		grace  = 400 * time.Millisecond
+	)
+	key := util.Must(psk.GeneratePSK())
+	g := testGroup(t, config.GroupConfig{PSK: &key, Expire: expire, LeaveGrace: grace})
+	events := subscribe(g)
+	addr := netip.MustParseAddr("10.0.0.1")
+
+	announced := time.Now()
+	if err := g.Ingest(testAnnouncement(key, 1000, addr, announced)); err != nil {
+		t.Fatal(err)
+	}
+	join := expectEvent(t, events, true, 0, time.Second)
+	if d := join.expiresAt.Sub(announced.Add(expire)).Abs(); d > 10*time.Millisecond {
+		t.Errorf("join event expiration %v is not announcement time plus expiration", join.expiresAt)
+	}
+	if items := g.List(); len(items) != 1 || items[0].ExpiresAt().Sub(announced.Add(expire)).Abs() > 10*time.Millisecond {
+		t.Fatalf("members %v, expected single member expiring at %v", items, announced.Add(expire))
+	}
+
+	// expired address is not listed during grace period, but it does not
+	// leave either
+	expectNoEvent(t, events, expire+grace/4)
+	if items := g.List(); len(items) != 0 {
+		t.Fatalf("expired address is listed: %v", items)
+	}
+
+	// returning within grace period produces no events
+	announced = time.Now()
+	if err := g.Ingest(testAnnouncement(key, 1000, addr, announced)); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.List()) != 1 {
+		t.Fatal("returned address is not listed")
+	}
+	expectNoEvent(t, events, expire+grace/2)
+
+	leave := expectEvent(t, events, false, 0, grace)
+	if d := leave.expiresAt.Sub(announced.Add(expire)).Abs(); d > 10*time.Millisecond {
+		t.Errorf("leave event expiration %v is not announcement time plus expiration", leave.expiresAt)
+	}
+}
+
+func TestGroupFlaps(t *testing.T) {
+	const expire = 100 * time.Millisecond
+	key := util.Must(psk.GeneratePSK())
+	g := testGroup(t, config.GroupConfig{PSK: &key, Expire: expire})
+	events := subscribe(g)
+	addr := netip.MustParseAddr("10.0.0.1")
+
+	for flaps := uint64(0); flaps < 3; flaps++ {
+		if err := g.Ingest(testAnnouncement(key, 1000, addr, time.Now())); err != nil {
+			t.Fatal(err)
+		}
+		expectEvent(t, events, true, flaps, time.Second)
+		if items := g.List(); len(items) != 1 || items[0].Flaps() != flaps {
+			t.Fatalf("members %v, expected single member with %d flaps", items, flaps)
+		}
+		// counter outlives membership, so it decays once address stays out
+		// of group. Announced addresses are kept in 16 byte form.
+		item := g.joins.Get(netip.AddrFrom16(addr.As16()))
+		if item == nil || item.ExpiresAt().Sub(time.Now().Add(expire+flapMemory)).Abs() > 50*time.Millisecond {
+			t.Fatalf("flap counter %v does not expire %v after membership", item, flapMemory)
+		}
+		expectEvent(t, events, false, flaps, time.Second)
+	}
+}
@@ -0,0 +1,165 @@
+package listener
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	httpSourceMaxBodySize = 4096
+)
+
+type HTTPSourceConfig struct {
+	BindAddress util.ExpandableString `yaml:"bind_address"`
+	Path        string
+	TLSCert     util.ExpandableString `yaml:"tls_cert"`
+	TLSKey      util.ExpandableString `yaml:"tls_key"`
+}
+
+type HTTPSource struct {
+	bindAddress string
+	path        string
+	tlsCert     string
+	tlsKey      string
+	label       string
+	callback    AnnouncementCallback
+	logger      *slog.Logger
+	server      *http.Server
+	loopDone    chan struct{}
+}
+
+func NewHTTPSource(cfg *config.SourceConfig, callback AnnouncementCallback, logger *slog.Logger) (*HTTPSource, error) {
+	var sc HTTPSourceConfig
+	if err := util.CheckedUnmarshal(&cfg.Spec, &sc); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal HTTP source config: %w", err)
+	}
+	if sc.BindAddress == "" {
+		return nil, errors.New("bind_address is not specified")
+	}
+	if (sc.TLSCert == "") != (sc.TLSKey == "") {
+		return nil, errors.New("tls_cert and tls_key must be specified together")
+	}
+	if sc.Path == "" {
+		sc.Path = "/"
+	}
+	label := string(sc.BindAddress) + sc.Path
+	return &HTTPSource{
+		bindAddress: string(sc.BindAddress),
+		path:        sc.Path,
+		tlsCert:     string(sc.TLSCert),
+		tlsKey:      string(sc.TLSKey),
+		label:       label,
+		callback:    callback,
+		logger:      logger.With("source", label, "kind", "http"),
+	}, nil
+}
+
+func (s *HTTPSource) Start() error {
+	mux := http.NewServeMux()
+	mux.Handle(s.path, s)
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelError),
+	}
+	if s.tlsCert != "" {
+		cert, err := s.loadCert()
+		if err != nil {
+			return err
+		}
+		s.server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}
+	}
+	ln, err := net.Listen("tcp", s.bindAddress)
+	if err != nil {
+		return fmt.Errorf("HTTP source listen failed: %w", err)
+	}
+	s.loopDone = make(chan struct{})
+	go func() {
+		defer close(s.loopDone)
+		var err error
+		if s.server.TLSConfig != nil {
+			err = s.server.ServeTLS(ln, "", "")
+		} else {
+			err = s.server.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("HTTP server error", "err", err)
+		}
+	}()
+	s.logger.Info("started HTTP source")
+	return nil
+}
+
+func (s *HTTPSource) Validate() error {
+	if _, err := net.ResolveTCPAddr("tcp", s.bindAddress); err != nil {
+		return fmt.Errorf("HTTP source %s: bad bind address: %w", s.label, err)
+	}
+	if s.tlsCert != "" {
+		if _, err := s.loadCert(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *HTTPSource) loadCert() (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(s.tlsCert, s.tlsKey)
+	if err != nil {
+		return cert, fmt.Errorf("HTTP source %s: unable to load TLS certificate: %w", s.label, err)
+	}
+	return cert, nil
+}
+
+func (s *HTTPSource) Stop() error {
+	s.server.Close()
+	<-s.loopDone
+	s.logger.Info("stopped HTTP source")
+	return nil
+}
+
+func (s *HTTPSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, httpSourceMaxBodySize))
+	if err != nil {
+		http.Error(w, "unable to read request body", http.StatusBadRequest)
+		return
+	}
+	ann := new(protocol.Announcement)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if err := json.Unmarshal(body, ann); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		if len(body) != protocol.AnnouncementSize {
+			http.Error(w, "bad announcement size", http.StatusBadRequest)
+			return
+		}
+		if err := ann.UnmarshalBinary(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	s.callback(s.label, r.RemoteAddr, ann)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,143 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/SenseUnit/rgap/agent"
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func testAnnouncement(key psk.PSK, group uint64, addr netip.Addr, ts time.Time) *protocol.Announcement {
+	ann := &protocol.Announcement{
+		Data: protocol.AnnouncementData{
+			Version:          protocol.V1,
+			RedundancyID:     group,
+			Timestamp:        ts.UnixMicro(),
+			AnnouncedAddress: addr.As16(),
+		},
+	}
+	ann.Signature = util.Must(ann.Data.CalculateSignature(key))
+	return ann
+}
+
+func testSourceConfig(t *testing.T, doc string) *config.SourceConfig {
+	t.Helper()
+	var cfg config.SourceConfig
+	if err := yaml.Unmarshal([]byte(doc), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return &cfg
+}
+
+// announcementSink collects announcements passed to source callback.
+type announcementSink struct {
+	mu   sync.Mutex
+	anns []protocol.Announcement
+}
+
+func (s *announcementSink) callback(_ string, _ string, ann *protocol.Announcement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.anns = append(s.anns, *ann)
+}
+
+func (s *announcementSink) received() []protocol.Announcement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]protocol.Announcement(nil), s.anns...)
+}
+
+func TestHTTPSourceConfig(t *testing.T) {
+	for _, doc := range []string{
+		"kind: http\nspec: {}",
+		"kind: http\nspec: {bind_address: 127.0.0.1:0, tls_cert: cert.pem}",
+		"kind: http\nspec: {bind_address: 127.0.0.1:0, unknown: 1}",
+	} {
+		if _, err := NewHTTPSource(testSourceConfig(t, doc), nil, testLogger); err == nil {
+			t.Errorf("config %q accepted", doc)
+		}
+	}
+}
+
+func TestHTTPSourceRequests(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	ann := testAnnouncement(key, 1000, netip.MustParseAddr("127.0.0.1"), time.Now())
+	bin := util.Must(ann.MarshalBinary())
+	doc := util.Must(json.Marshal(ann))
+
+	for _, tc := range []struct {
+		name        string
+		method      string
+		contentType string
+		body        []byte
+		status      int
+	}{
+		{"binary", http.MethodPost, "application/octet-stream", bin, http.StatusNoContent},
+		{"json", http.MethodPost, "application/json; charset=utf-8", doc, http.StatusNoContent},
+		{"bad method", http.MethodGet, "", nil, http.StatusMethodNotAllowed},
+		{"bad size", http.MethodPost, "application/octet-stream", bin[1:], http.StatusBadRequest},
+		{"bad json", http.MethodPost, "application/json", []byte("{"), http.StatusBadRequest},
+		{"too large", http.MethodPost, "application/json", bytes.Repeat([]byte(" "), httpSourceMaxBodySize+1), http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := new(announcementSink)
+			src := util.Must(NewHTTPSource(testSourceConfig(t, "kind: http\nspec: {bind_address: 127.0.0.1:0}"), sink.callback, testLogger))
+			req := httptest.NewRequest(tc.method, "/", bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rec := httptest.NewRecorder()
+			src.ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Fatalf("status %d, expected %d", rec.Code, tc.status)
+			}
+			received := sink.received()
+			if tc.status != http.StatusNoContent {
+				if len(received) != 0 {
+					t.Fatalf("rejected request produced announcements: %v", received)
+				}
+				return
+			}
+			if len(received) != 1 || received[0] != *ann {
+				t.Fatalf("received %v, expected %v", received, *ann)
+			}
+		})
+	}
+}
+
+func TestHTTPSourceAgentDestination(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	ann := testAnnouncement(key, 1000, netip.MustParseAddr("10.0.0.1"), time.Now())
+	sink := new(announcementSink)
+	src := util.Must(NewHTTPSource(testSourceConfig(t, "kind: http\nspec: {bind_address: 127.0.0.1:0}"), sink.callback, testLogger))
+	srv := httptest.NewServer(src)
+	defer srv.Close()
+
+	sender := agent.NewSender(nil)
+	if err := sender.SendSingle(context.Background(), util.Must(ann.MarshalBinary()), srv.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+	if received := sink.received(); len(received) != 1 || received[0] != *ann {
+		t.Fatalf("received %v, expected %v", received, *ann)
+	}
+	if err := sender.SendSingle(context.Background(), []byte("garbage"), srv.URL+"/"); err == nil {
+		t.Fatal("rejected announcement reported as sent")
+	}
+}
@@ -2,62 +2,146 @@ package listener
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
 
 	"github.com/SenseUnit/rgap/config"
 	"github.com/SenseUnit/rgap/iface"
 	"github.com/SenseUnit/rgap/output"
 	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/util"
 )
 
 type Listener struct {
-	sources []iface.StartStopper
-	groups  map[uint64]*Group
-	outputs []iface.StartStopper
+	sources    []iface.StartStopper
+	sourcePos  []config.Position
+	groups     map[uint64]*Group
+	cluster    *Cluster
+	outputs    []iface.StartStopper
+	rejections rejectionHub
+	logger     *slog.Logger
 }
 
-func NewListener(cfg *config.ListenerConfig) (*Listener, error) {
+// NewListener constructs listener from config. It doesn't stop on first
+// configuration error, but reports all of them at once.
+func NewListener(cfg *config.ListenerConfig, logger *slog.Logger) (*Listener, error) {
 	l := &Listener{
-		groups: make(map[uint64]*Group),
+		groups:     make(map[uint64]*Group),
+		rejections: rejectionHub{logger: logger},
+		logger:     logger,
 	}
+	var resErr error
+	groupPos := make(map[uint64]config.Position)
 	for i, gc := range cfg.Groups {
-		g, err := GroupFromConfig(&gc)
+		if pos, dup := groupPos[gc.ID]; dup {
+			resErr = multierror.Append(resErr, gc.Pos.Errorf("duplicate group with id %d at index %d, first defined at %s", gc.ID, i, pos))
+			continue
+		}
+		groupPos[gc.ID] = gc.Pos
+		g, err := GroupFromConfig(&gc, logger)
 		if err != nil {
-			return nil, fmt.Errorf("unable to construct new group with index %d: %w", i, err)
+			resErr = multierror.Append(resErr, gc.Pos.Errorf("unable to construct new group with index %d: %w", i, err))
+			continue
 		}
 		l.groups[g.ID()] = g
 	}
-	for _, address := range cfg.Listen {
-		src := NewUDPSource(address, address, l.announceCallback)
+	if cfg.Cluster != nil {
+		cluster, err := ClusterFromConfig(cfg.Cluster, l.groups, logger)
+		if err != nil {
+			resErr = multierror.Append(resErr, cfg.Cluster.Pos.Errorf("unable to construct cluster node: %w", err))
+		}
+		l.cluster = cluster
+	}
+	for i, address := range util.PlainStrings(cfg.Listen) {
+		src := NewUDPSource(address, address, l.announceCallback, logger)
 		l.sources = append(l.sources, src)
+		var pos config.Position
+		if i < len(cfg.ListenPos) {
+			pos = cfg.ListenPos[i]
+		}
+		l.sourcePos = append(l.sourcePos, pos)
+	}
+	for i, sc := range cfg.Sources {
+		src, err := SourceFromConfig(&sc, l.announceCallback, logger)
+		if err != nil {
+			resErr = multierror.Append(resErr, sc.Pos.Errorf("unable to construct new source with index %d: %w", i, err))
+			continue
+		}
+		l.sources = append(l.sources, src)
+		l.sourcePos = append(l.sourcePos, sc.Pos)
 	}
 	for i, oc := range cfg.Outputs {
-		out, err := output.OutputFromConfig(&oc, l)
+		out, err := output.OutputFromConfig(&oc, l, logger)
 		if err != nil {
-			return nil, fmt.Errorf("unable to construct new output with index %d: %w", i, err)
+			resErr = multierror.Append(resErr, oc.Pos.Errorf("unable to construct new output with index %d: %w", i, err))
+			continue
 		}
 		l.outputs = append(l.outputs, out)
 	}
+	if resErr != nil {
+		return nil, resErr
+	}
 	return l, nil
 }
 
-func (l *Listener) announceCallback(label string, ann *protocol.Announcement) {
+// Validate checks constructed components against environment, e.g.
+// resolves listen addresses and interfaces, without binding any sockets.
+func (l *Listener) Validate() error {
+	var resErr error
+	for i, src := range l.sources {
+		v, ok := src.(iface.Validator)
+		if !ok {
+			continue
+		}
+		if err := v.Validate(); err != nil {
+			resErr = multierror.Append(resErr, l.sourcePos[i].Errorf("%w", err))
+		}
+	}
+	return resErr
+}
+
+func (l *Listener) announceCallback(label, sender string, ann *protocol.Announcement) {
 	group, ok := l.groups[ann.Data.RedundancyID]
 	if !ok {
+		l.reject(label, sender, ann, &RejectError{
+			Reason: iface.RejectUnknownGroup,
+			Drift:  time.Since(time.UnixMicro(ann.Data.Timestamp)),
+		})
 		return
 	}
 	if err := group.Ingest(ann); err != nil {
-		log.Printf("Group %d ingestion error: %v", group.ID(), err)
+		var rejectErr *RejectError
+		if errors.As(err, &rejectErr) {
+			l.reject(label, sender, ann, rejectErr)
+			return
+		}
+		l.logger.Error("group ingestion error", "group", group.ID(), "source", label, "sender", sender, "err", err)
 	}
 }
 
+func (l *Listener) reject(label, sender string, ann *protocol.Announcement, rejectErr *RejectError) {
+	l.rejections.publish(&rejection{
+		time:    time.Now(),
+		source:  label,
+		sender:  sender,
+		group:   ann.Data.RedundancyID,
+		address: netip.AddrFrom16(ann.Data.AnnouncedAddress).Unmap(),
+		reason:  rejectErr.Reason,
+		drift:   rejectErr.Drift,
+	})
+}
+
 func (l *Listener) Run(ctx context.Context) error {
 	var primeStack []iface.StartStopper
 	defer func() {
 		for i := len(primeStack) - 1; i >= 0; i-- {
 			if err := primeStack[i].Stop(); err != nil {
-				log.Printf("shutdown error: %v", err)
+				l.logger.Error("shutdown error", "err", err)
 			}
 		}
 	}()
@@ -67,6 +151,12 @@ func (l *Listener) Run(ctx context.Context) error {
 		}
 		primeStack = append(primeStack, group)
 	}
+	if l.cluster != nil {
+		if err := l.cluster.Start(); err != nil {
+			return fmt.Errorf("startup error: %w", err)
+		}
+		primeStack = append(primeStack, l.cluster)
+	}
 	for _, source := range l.sources {
 		if err := source.Start(); err != nil {
 			return fmt.Errorf("startup error: %w", err)
@@ -79,9 +169,9 @@ func (l *Listener) Run(ctx context.Context) error {
 		}
 		primeStack = append(primeStack, out)
 	}
-	log.Println("Listener is now operational.")
+	l.logger.Info("listener is now operational")
 	<-ctx.Done()
-	log.Println("Listener is shutting down.")
+	l.logger.Info("listener is shutting down")
 	return nil
 }
 
@@ -109,6 +199,14 @@ func (l *Listener) GroupReady(id uint64) bool {
 	return g.Ready()
 }
 
+func (l *Listener) GroupDegraded(id uint64) bool {
+	g, ok := l.groups[id]
+	if !ok {
+		return false
+	}
+	return g.Degraded()
+}
+
 func (l *Listener) GroupReadinessBarrier(id uint64) <-chan struct{} {
 	g, ok := l.groups[id]
 	if !ok {
@@ -134,3 +232,7 @@ func (l *Listener) OnLeave(group uint64, cb iface.GroupEventCallback) func() {
 	}
 	return g.OnLeave(cb)
 }
+
+func (l *Listener) OnReject(cb iface.RejectionCallback) func() {
+	return l.rejections.subscribe(cb)
+}
@@ -0,0 +1,69 @@
+package listener
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SenseUnit/rgap/config"
+)
+
+func TestListenerDuplicateGroups(t *testing.T) {
+	dir := t.TempDir()
+	const group = "  - id: 1000\n    psk: 8ba0c4a6f5b4c6c9fa7ef7d0e2c5e4b1a3f6d8e9c0b1a2d3e4f5a6b7c8d9e0f1\n    expire: 15s\n"
+	for name, content := range map[string]string{
+		"00-first.yaml":  "groups:\n" + group,
+		"10-second.yaml": "# duplicate\ngroups:\n" + group,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := config.LoadListenerConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewListener(cfg, testLogger)
+	if err == nil {
+		t.Fatal("duplicate group accepted")
+	}
+	expected := filepath.Join(dir, "10-second.yaml") + ": line 3: duplicate group with id 1000 at index 1, first defined at " +
+		filepath.Join(dir, "00-first.yaml") + ": line 2"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("error %q does not contain %q", err, expected)
+	}
+}
+
+func TestListenerSpecReferences(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rgap.yaml")
+	content := "outputs:\n  - kind: hostsfile\n    spec:\n      interval: 1m\n      filename: ${RGAP_TEST_HOSTS}\n" +
+		"  - kind: command\n    spec:\n      group: 1000\n      command: [sh, -c, 'echo ${RGAP_TEST_UNSET_ARG}']\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	build := func() error {
+		cfg, err := config.LoadListenerConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewListener(cfg, testLogger)
+		return err
+	}
+
+	// values which don't opt in to expansion, like command arguments,
+	// are used literally
+	t.Setenv("RGAP_TEST_HOSTS", filepath.Join(dir, "hosts"))
+	if err := build(); err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv("RGAP_TEST_HOSTS")
+	err := build()
+	if err == nil {
+		t.Fatal("output with unset variable constructed")
+	}
+	if !strings.Contains(err.Error(), `"RGAP_TEST_HOSTS"`) || !strings.Contains(err.Error(), path+": line 2") {
+		t.Errorf("error %q doesn't name variable and position", err)
+	}
+}
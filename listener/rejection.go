@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/SenseUnit/rgap/iface"
+)
+
+type RejectError struct {
+	Reason string
+	Drift  time.Duration
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("announcement rejected: %s", e.Reason)
+}
+
+type rejection struct {
+	time    time.Time
+	source  string
+	sender  string
+	group   uint64
+	address netip.Addr
+	reason  string
+	drift   time.Duration
+}
+
+func (r *rejection) Time() time.Time {
+	return r.time
+}
+
+func (r *rejection) Source() string {
+	return r.source
+}
+
+func (r *rejection) Sender() string {
+	return r.sender
+}
+
+func (r *rejection) Group() uint64 {
+	return r.group
+}
+
+func (r *rejection) Address() netip.Addr {
+	return r.address
+}
+
+func (r *rejection) Reason() string {
+	return r.reason
+}
+
+func (r *rejection) Drift() time.Duration {
+	return r.drift
+}
+
+const rejectionQueueSize = 1024
+
+// rejectionSub delivers rejections to subscriber callback in its own
+// goroutine, so slow outputs don't stall source read loops.
+type rejectionSub struct {
+	queue chan iface.Rejection
+	done  chan struct{}
+}
+
+type rejectionHub struct {
+	mu     sync.RWMutex
+	nextID uint64
+	subs   map[uint64]*rejectionSub
+	logger *slog.Logger
+}
+
+func (h *rejectionHub) subscribe(cb iface.RejectionCallback) func() {
+	sub := &rejectionSub{
+		queue: make(chan iface.Rejection, rejectionQueueSize),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(sub.done)
+		for r := range sub.queue {
+			cb(r)
+		}
+	}()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[uint64]*rejectionSub)
+	}
+	id := h.nextID
+	h.nextID++
+	h.subs[id] = sub
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, id)
+			close(sub.queue)
+			h.mu.Unlock()
+			// callback is not invoked after unsubscribe returns
+			<-sub.done
+		})
+	}
+}
+
+func (h *rejectionHub) publish(r iface.Rejection) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, sub := range h.subs {
+		select {
+		case sub.queue <- r:
+		default:
+			if h.logger != nil {
+				h.logger.Warn("rejection queue is full, dropping event", "source", r.Source(), "sender", r.Sender())
+			}
+		}
+	}
+}
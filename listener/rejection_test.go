@@ -0,0 +1,112 @@
+package listener
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/iface"
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+func TestListenerRejections(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	l := &Listener{
+		groups:     map[uint64]*Group{1000: testGroup(t, config.GroupConfig{PSK: &key})},
+		rejections: rejectionHub{logger: testLogger},
+		logger:     testLogger,
+	}
+	events := make(chan iface.Rejection, 10)
+	unsub := l.OnReject(func(r iface.Rejection) { events <- r })
+	defer unsub()
+
+	addr := netip.MustParseAddr("10.0.0.1")
+	unsupported := testAnnouncement(key, 1000, addr, time.Now())
+	unsupported.Data.Version++
+	for _, tc := range []struct {
+		ann    *protocol.Announcement
+		reason string
+		drift  time.Duration
+	}{
+		{testAnnouncement(key, 2000, addr, time.Now()), iface.RejectUnknownGroup, 0},
+		{testAnnouncement(util.Must(psk.GeneratePSK()), 1000, addr, time.Now()), iface.RejectBadSignature, 0},
+		{testAnnouncement(key, 1000, addr, time.Now().Add(-time.Hour)), iface.RejectClockSkew, time.Hour},
+		{unsupported, iface.RejectUnsupportedVersion, 0},
+	} {
+		l.announceCallback("udp", "192.0.2.1:12345", tc.ann)
+		select {
+		case r := <-events:
+			if r.Reason() != tc.reason || r.Source() != "udp" || r.Sender() != "192.0.2.1:12345" ||
+				r.Group() != tc.ann.Data.RedundancyID || r.Address() != addr {
+				t.Errorf("unexpected rejection: reason=%q source=%q sender=%q group=%d address=%s",
+					r.Reason(), r.Source(), r.Sender(), r.Group(), r.Address())
+			}
+			if (r.Drift() - tc.drift).Abs() > 10*time.Second {
+				t.Errorf("%s: drift %v, expected about %v", tc.reason, r.Drift(), tc.drift)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no rejection event for %q", tc.reason)
+		}
+	}
+
+	// valid announcement is not rejected
+	l.announceCallback("udp", "192.0.2.1:12345", testAnnouncement(key, 1000, addr, time.Now()))
+	select {
+	case r := <-events:
+		t.Errorf("valid announcement rejected: %s", r.Reason())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRejectionHubSlowSubscriber(t *testing.T) {
+	hub := rejectionHub{logger: testLogger}
+	release := make(chan struct{})
+	var slowCalls, fastCalls int
+	fastDone := make(chan struct{})
+	unsubSlow := hub.subscribe(func(iface.Rejection) {
+		<-release
+		slowCalls++
+	})
+	unsubFast := hub.subscribe(func(iface.Rejection) {
+		fastCalls++
+		if fastCalls == rejectionQueueSize {
+			close(fastDone)
+		}
+	})
+
+	// publishing never waits for subscribers, even when queue is full
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < rejectionQueueSize+10; i++ {
+			hub.publish(&rejection{reason: iface.RejectBadSignature})
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish is blocked by slow subscriber")
+	}
+	select {
+	case <-fastDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("fast subscriber got %d events", fastCalls)
+	}
+
+	close(release)
+	unsubSlow()
+	unsubFast()
+	// events queued before unsubscribe are delivered, and callbacks are
+	// not running anymore once unsubscribe returns
+	if slowCalls < rejectionQueueSize || slowCalls > rejectionQueueSize+1 {
+		t.Errorf("slow subscriber got %d events", slowCalls)
+	}
+	if fastCalls < rejectionQueueSize {
+		t.Errorf("fast subscriber got %d events", fastCalls)
+	}
+	hub.publish(&rejection{reason: iface.RejectBadSignature})
+	unsubSlow()
+}
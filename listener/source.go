@@ -0,0 +1,77 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/iface"
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/util"
+)
+
+type AnnouncementCallback = func(label string, sender string, ann *protocol.Announcement)
+
+type SourceCtor func(*config.SourceConfig, AnnouncementCallback, *slog.Logger) (iface.StartStopper, error)
+
+type UDPSourceConfig struct {
+	Address string
+}
+
+type sourceKind struct {
+	ctor SourceCtor
+	// zero value of spec type, used for schema generation
+	spec interface{}
+}
+
+var sourceVCMap = map[string]sourceKind{
+	"udp": {
+		ctor: func(cfg *config.SourceConfig, callback AnnouncementCallback, logger *slog.Logger) (iface.StartStopper, error) {
+			var sc UDPSourceConfig
+			if err := util.CheckedUnmarshal(&cfg.Spec, &sc); err != nil {
+				return nil, fmt.Errorf("cannot unmarshal UDP source config: %w", err)
+			}
+			if sc.Address == "" {
+				return nil, errors.New("address is not specified")
+			}
+			return NewUDPSource(sc.Address, sc.Address, callback, logger), nil
+		},
+		spec: UDPSourceConfig{},
+	},
+	"http": {
+		ctor: func(cfg *config.SourceConfig, callback AnnouncementCallback, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewHTTPSource(cfg, callback, logger)
+		},
+		spec: HTTPSourceConfig{},
+	},
+	"unixgram": {
+		ctor: func(cfg *config.SourceConfig, callback AnnouncementCallback, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewUnixSource("unixgram", cfg, callback, logger)
+		},
+		spec: UnixSourceConfig{},
+	},
+	"unix": {
+		ctor: func(cfg *config.SourceConfig, callback AnnouncementCallback, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewUnixSource("unix", cfg, callback, logger)
+		},
+		spec: UnixSourceConfig{},
+	},
+}
+
+func SourceFromConfig(cfg *config.SourceConfig, callback AnnouncementCallback, logger *slog.Logger) (iface.StartStopper, error) {
+	kind, ok := sourceVCMap[cfg.Kind]
+	if !ok {
+		return nil, errors.New("unknown kind of source")
+	}
+	return kind.ctor(cfg, callback, logger)
+}
+
+// SourceSpecs returns zero values of spec types of all known source kinds.
+func SourceSpecs() map[string]interface{} {
+	res := make(map[string]interface{}, len(sourceVCMap))
+	for name, kind := range sourceVCMap {
+		res[name] = kind.spec
+	}
+	return res
+}
@@ -1,47 +1,61 @@
 package listener
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 
 	"github.com/SenseUnit/rgap/protocol"
 	"github.com/SenseUnit/rgap/util"
 )
 
+// PayloadCallback receives datagrams as they are, before any validation.
+type PayloadCallback = func(label string, sender string, payload []byte)
+
 type UDPSource struct {
 	address   string
 	label     string
-	callback  func(string, *protocol.Announcement)
+	callback  AnnouncementCallback
+	raw       PayloadCallback
+	logger    *slog.Logger
 	ctx       context.Context
 	ctxCancel func()
 	loopDone  chan struct{}
 }
 
-func NewUDPSource(address string, label string, callback func(string, *protocol.Announcement)) *UDPSource {
+func NewUDPSource(address string, label string, callback AnnouncementCallback, logger *slog.Logger) *UDPSource {
 	s := &UDPSource{
 		address:  address,
 		label:    label,
 		callback: callback,
+		logger:   logger.With("source", label, "kind", "udp"),
 	}
 	return s
 }
 
+// NewRawUDPSource returns UDPSource which passes every received datagram to
+// callback, including ones which are not announcements. It's useful for
+// troubleshooting.
+func NewRawUDPSource(address string, label string, callback PayloadCallback, logger *slog.Logger) *UDPSource {
+	return &UDPSource{
+		address: address,
+		label:   label,
+		raw:     callback,
+		logger:  logger.With("source", label, "kind", "udp"),
+	}
+}
+
 func (s *UDPSource) Start() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	s.ctx = ctx
 	s.ctxCancel = cancel
 	s.loopDone = make(chan struct{})
 
-	listenAddr, iface, err := util.SplitAndResolveAddrSpec(s.address)
-	if err != nil {
-		return fmt.Errorf("UDP source %s: interface resolving failed: %w", s.address, err)
-	}
-
-	udpAddr, err := net.ResolveUDPAddr("udp", listenAddr)
+	udpAddr, iface, err := s.resolve()
 	if err != nil {
-		return fmt.Errorf("bad UDP listen address: %w", err)
+		return err
 	}
 
 	var conn *net.UDPConn
@@ -66,14 +80,32 @@ func (s *UDPSource) Start() error {
 		conn.Close()
 	}()
 	go s.readLoop(conn)
-	log.Printf("Started UDP source @ %s", s.address)
+	s.logger.Info("started UDP source", "address", s.address)
 	return nil
 }
 
+func (s *UDPSource) Validate() error {
+	_, _, err := s.resolve()
+	return err
+}
+
+func (s *UDPSource) resolve() (*net.UDPAddr, *net.Interface, error) {
+	listenAddr, iface, err := util.SplitAndResolveAddrSpec(s.address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("UDP source %s: interface resolving failed: %w", s.address, err)
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", listenAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad UDP listen address: %w", err)
+	}
+	return udpAddr, iface, nil
+}
+
 func (s *UDPSource) Stop() error {
 	s.ctxCancel()
 	<-s.loopDone
-	log.Printf("Stopped UDP source @ %s", s.address)
+	s.logger.Info("stopped UDP source", "address", s.address)
 	return nil
 }
 
@@ -81,12 +113,16 @@ func (s *UDPSource) readLoop(conn *net.UDPConn) {
 	defer close(s.loopDone)
 	buf := make([]byte, 4096)
 	for s.ctx.Err() == nil {
-		n, _, err := conn.ReadFromUDP(buf)
+		n, sender, err := conn.ReadFromUDP(buf)
 		if err != nil {
 			if s.ctx.Err() != nil {
 				return
 			}
-			log.Printf("source %s: UDP read error: %v", s.label, err)
+			s.logger.Error("UDP read error", "err", err)
+			continue
+		}
+		if s.raw != nil {
+			s.raw(s.label, sender.String(), bytes.Clone(buf[:n]))
 			continue
 		}
 		if n != protocol.AnnouncementSize {
@@ -94,8 +130,9 @@ func (s *UDPSource) readLoop(conn *net.UDPConn) {
 		}
 		ann := new(protocol.Announcement)
 		if err := ann.UnmarshalBinary(buf[:n]); err != nil {
-			log.Printf("announce unmarshaling failed: %v", err)
+			s.logger.Warn("announce unmarshaling failed", "err", err)
+			continue
 		}
-		s.callback(s.label, ann)
+		s.callback(s.label, sender.String(), ann)
 	}
 }
@@ -0,0 +1,69 @@
+package listener
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRawUDPSource(t *testing.T) {
+	// find free port
+	probe, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := probe.LocalAddr().String()
+	probe.Close()
+
+	var (
+		mu       sync.Mutex
+		payloads [][]byte
+		senders  []string
+	)
+	src := NewRawUDPSource(address, "test", func(label, sender string, payload []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		payloads = append(payloads, payload)
+		senders = append(senders, sender)
+	}, testLogger)
+	if err := src.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer src.Stop()
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// datagrams which are not announcements are passed as well
+	sent := [][]byte{[]byte("short"), bytes.Repeat([]byte{1}, 200)}
+	for _, p := range sent {
+		if _, err := conn.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		n := len(payloads)
+		mu.Unlock()
+		if n >= len(sent) {
+			break
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(payloads) != len(sent) {
+		t.Fatalf("received %d datagrams, expected %d", len(payloads), len(sent))
+	}
+	for i := range sent {
+		if !bytes.Equal(payloads[i], sent[i]) {
+			t.Errorf("datagram %d: got %q, expected %q", i, payloads[i], sent[i])
+		}
+		if senders[i] != conn.LocalAddr().String() {
+			t.Errorf("datagram %d: sender %s, expected %s", i, senders[i], conn.LocalAddr())
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	acceptMinDelay = 5 * time.Millisecond
+	acceptMaxDelay = 1 * time.Second
+)
+
+type UnixSourceConfig struct {
+	Path  util.ExpandableString
+	Mode  string
+	Owner string
+	Group string
+}
+
+type UnixSource struct {
+	network   string
+	path      string
+	mode      fs.FileMode
+	uid       int
+	gid       int
+	callback  AnnouncementCallback
+	logger    *slog.Logger
+	ctx       context.Context
+	ctxCancel func()
+	loopDone  chan struct{}
+	conns     sync.WaitGroup
+}
+
+func NewUnixSource(network string, cfg *config.SourceConfig, callback AnnouncementCallback, logger *slog.Logger) (*UnixSource, error) {
+	var sc UnixSourceConfig
+	if err := util.CheckedUnmarshal(&cfg.Spec, &sc); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal unix source config: %w", err)
+	}
+	if sc.Path == "" {
+		return nil, errors.New("path is not specified")
+	}
+	s := &UnixSource{
+		network:  network,
+		path:     string(sc.Path),
+		uid:      -1,
+		gid:      -1,
+		callback: callback,
+		logger:   logger.With("source", string(sc.Path), "kind", network),
+	}
+	if sc.Mode != "" {
+		mode, err := strconv.ParseUint(sc.Mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad socket file mode %q: %w", sc.Mode, err)
+		}
+		s.mode = fs.FileMode(mode) & fs.ModePerm
+	}
+	if sc.Owner != "" {
+		uid, err := lookupID(sc.Owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve socket owner %q: %w", sc.Owner, err)
+		}
+		s.uid = uid
+	}
+	if sc.Group != "" {
+		gid, err := lookupID(sc.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve socket group %q: %w", sc.Group, err)
+		}
+		s.gid = gid
+	}
+	return s, nil
+}
+
+func lookupID(spec string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(spec); err == nil {
+		return id, nil
+	}
+	idStr, err := lookup(spec)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(idStr)
+}
+
+func (s *UnixSource) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.ctx = ctx
+	s.ctxCancel = cancel
+	s.loopDone = make(chan struct{})
+
+	if err := removeStaleSocket(s.path); err != nil {
+		return fmt.Errorf("unix source %s: %w", s.path, err)
+	}
+
+	addr := &net.UnixAddr{
+		Name: s.path,
+		Net:  s.network,
+	}
+	var closer io.Closer
+	switch s.network {
+	case "unixgram":
+		conn, err := net.ListenUnixgram(s.network, addr)
+		if err != nil {
+			return fmt.Errorf("unix source listen failed: %w", err)
+		}
+		closer = conn
+		go s.readLoop(conn)
+	case "unix":
+		ln, err := net.ListenUnix(s.network, addr)
+		if err != nil {
+			return fmt.Errorf("unix source listen failed: %w", err)
+		}
+		closer = ln
+		go s.acceptLoop(ln)
+	default:
+		return fmt.Errorf("unsupported unix socket network %q", s.network)
+	}
+
+	if err := s.setPermissions(); err != nil {
+		cancel()
+		closer.Close()
+		<-s.loopDone
+		if s.network == "unixgram" {
+			os.Remove(s.path)
+		}
+		return fmt.Errorf("unix source %s: %w", s.path, err)
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.loopDone:
+		}
+		closer.Close()
+	}()
+	s.logger.Info("started unix socket source")
+	return nil
+}
+
+// removeStaleSocket unlinks socket left by previous run. Other files and
+// sockets which still accept connections are left intact.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode().Type() != fs.ModeSocket {
+		return nil
+	}
+	for _, network := range []string{"unix", "unixgram"} {
+		if conn, err := net.DialTimeout(network, path, time.Second); err == nil {
+			conn.Close()
+			return errors.New("socket is in use by another process")
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("unable to remove stale socket: %w", err)
+	}
+	return nil
+}
+
+func (s *UnixSource) setPermissions() error {
+	if s.mode != 0 {
+		if err := os.Chmod(s.path, s.mode); err != nil {
+			return fmt.Errorf("unable to set socket file mode: %w", err)
+		}
+	}
+	if s.uid != -1 || s.gid != -1 {
+		if err := os.Chown(s.path, s.uid, s.gid); err != nil {
+			return fmt.Errorf("unable to set socket file owner: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *UnixSource) Stop() error {
+	s.ctxCancel()
+	<-s.loopDone
+	s.conns.Wait()
+	if s.network == "unixgram" {
+		// datagram sockets are not unlinked on close
+		os.Remove(s.path)
+	}
+	s.logger.Info("stopped unix socket source")
+	return nil
+}
+
+func (s *UnixSource) readLoop(conn *net.UnixConn) {
+	defer close(s.loopDone)
+	buf := make([]byte, 4096)
+	for s.ctx.Err() == nil {
+		n, sender, err := conn.ReadFromUnix(buf)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("unix socket read error", "err", err)
+			continue
+		}
+		if n != protocol.AnnouncementSize {
+			continue
+		}
+		ann := new(protocol.Announcement)
+		if err := ann.UnmarshalBinary(buf[:n]); err != nil {
+			s.logger.Warn("announce unmarshaling failed", "err", err)
+			continue
+		}
+		var senderName string
+		if sender != nil {
+			senderName = sender.Name
+		}
+		s.callback(s.path, senderName, ann)
+	}
+}
+
+func (s *UnixSource) acceptLoop(ln *net.UnixListener) {
+	defer close(s.loopDone)
+	var delay time.Duration
+	for s.ctx.Err() == nil {
+		conn, err := ln.AcceptUnix()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			// back off on persistent errors like EMFILE, as
+			// net/http.Server does
+			delay = min(max(2*delay, acceptMinDelay), acceptMaxDelay)
+			s.logger.Error("unix socket accept error", "err", err, "retry_in", delay)
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			continue
+		}
+		delay = 0
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+func (s *UnixSource) handleConn(conn *net.UnixConn) {
+	connDone := make(chan struct{})
+	defer close(connDone)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+		case <-connDone:
+		}
+		conn.Close()
+	}()
+	// stream carries fixed-size announcements back to back
+	buf := make([]byte, protocol.AnnouncementSize)
+	for {
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			if s.ctx.Err() == nil && !errors.Is(err, io.EOF) {
+				s.logger.Error("unix socket read error", "err", err)
+			}
+			return
+		}
+		ann := new(protocol.Announcement)
+		if err := ann.UnmarshalBinary(buf); err != nil {
+			s.logger.Warn("announce unmarshaling failed", "err", err)
+			return
+		}
+		s.callback(s.path, "", ann)
+	}
+}
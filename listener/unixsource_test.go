@@ -0,0 +1,130 @@
+package listener
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SenseUnit/rgap/agent"
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+func waitAnnouncements(t *testing.T, sink *announcementSink, n int) []protocol.Announcement {
+	t.Helper()
+	var received []protocol.Announcement
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if received = sink.received(); len(received) >= n {
+			return received
+		}
+	}
+	t.Fatalf("received %d announcements, expected %d", len(received), n)
+	return nil
+}
+
+func TestUnixSourceConfig(t *testing.T) {
+	for _, doc := range []string{
+		"kind: unix\nspec: {}",
+		"kind: unix\nspec: {path: /tmp/rgap.sock, mode: '0999'}",
+		"kind: unix\nspec: {path: /tmp/rgap.sock, owner: no-such-user-rgap}",
+	} {
+		if _, err := NewUnixSource("unix", testSourceConfig(t, doc), nil, testLogger); err == nil {
+			t.Errorf("config %q accepted", doc)
+		}
+	}
+}
+
+func TestUnixSource(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+	for _, network := range []string{"unixgram", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rgap.sock")
+			// stale socket of previous run should be replaced
+			stale := util.Must(net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"}))
+			stale.Close()
+
+			sink := new(announcementSink)
+			src := util.Must(NewUnixSource(network, testSourceConfig(t, "kind: "+network+"\nspec: {path: "+path+", mode: '0600'}"), sink.callback, testLogger))
+			if err := src.Start(); err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != 0600 {
+				t.Errorf("socket mode %v, expected 0600", fi.Mode().Perm())
+			}
+
+			first := testAnnouncement(key, 1000, netip.MustParseAddr("10.0.0.1"), time.Now())
+			second := testAnnouncement(key, 1000, netip.MustParseAddr("10.0.0.2"), time.Now())
+			if err := agent.NewSender(nil).SendSingle(context.Background(), util.Must(first.MarshalBinary()), "unix:"+path); err != nil {
+				t.Fatal(err)
+			}
+			waitAnnouncements(t, sink, 1)
+			conn := util.Must(net.Dial(network, path))
+			conn.Write([]byte("short"))
+			if network == "unix" {
+				// stream carries back to back announcements, so write
+				// second one right after first
+				conn.Close()
+				conn = util.Must(net.Dial(network, path))
+				conn.Write(append(util.Must(first.MarshalBinary()), util.Must(second.MarshalBinary())...))
+			} else {
+				conn.Write(util.Must(second.MarshalBinary()))
+			}
+			conn.Close()
+			received := waitAnnouncements(t, sink, 2)
+			if received[0] != *first || received[len(received)-1] != *second {
+				t.Errorf("received %v, expected %v and %v", received, *first, *second)
+			}
+
+			if err := src.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("socket file is left after stop: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnixSourceExistingPath(t *testing.T) {
+	dir := t.TempDir()
+
+	// socket of another running listener is not unlinked
+	path := filepath.Join(dir, "live.sock")
+	live := util.Must(net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"}))
+	defer live.Close()
+	for _, network := range []string{"unixgram", "unix"} {
+		src := util.Must(NewUnixSource(network, testSourceConfig(t, "kind: "+network+"\nspec: {path: "+path+"}"), nil, testLogger))
+		if err := src.Start(); err == nil {
+			src.Stop()
+			t.Errorf("%s: socket in use was replaced", network)
+		}
+	}
+	if conn, err := net.Dial("unix", path); err != nil {
+		t.Errorf("live socket is broken: %v", err)
+	} else {
+		conn.Close()
+	}
+
+	// regular file is not removed
+	path = filepath.Join(dir, "file")
+	if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	src := util.Must(NewUnixSource("unix", testSourceConfig(t, "kind: unix\nspec: {path: "+path+"}"), nil, testLogger))
+	if err := src.Start(); err == nil {
+		src.Stop()
+		t.Errorf("regular file was replaced")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+		t.Errorf("regular file was modified: %q %v", data, err)
+	}
+}
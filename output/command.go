@@ -5,7 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os/exec"
 	"sync"
 	"time"
@@ -34,9 +34,10 @@ type Command struct {
 	shutdown  chan struct{}
 	busy      sync.WaitGroup
 	unsubFns  []func()
+	logger    *slog.Logger
 }
 
-func NewCommand(cfg *config.OutputConfig, bridge iface.GroupBridge) (*Command, error) {
+func NewCommand(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (*Command, error) {
 	var cc CommandConfig
 	if err := util.CheckedUnmarshal(&cfg.Spec, &cc); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal command output config: %w", err)
@@ -64,6 +65,7 @@ func NewCommand(cfg *config.OutputConfig, bridge iface.GroupBridge) (*Command, e
 		waitDelay: waitDelay,
 		syncQueue: make(chan struct{}, 1),
 		shutdown:  make(chan struct{}),
+		logger:    logger.With("group", *cc.Group, "command", cc.Command),
 	}, nil
 }
 
@@ -85,7 +87,7 @@ func (o *Command) Start() error {
 		}),
 	)
 	o.sync()
-	log.Println("started command output plugin")
+	o.logger.Info("started command output plugin")
 	return nil
 }
 
@@ -94,9 +96,9 @@ func (o *Command) Stop() error {
 		unsub()
 	}
 	close(o.shutdown)
-	log.Println("command output plugin stopping - waiting commands to finish...")
+	o.logger.Info("command output plugin stopping - waiting commands to finish...")
 	o.busy.Wait()
-	log.Println("stopped command output plugin")
+	o.logger.Info("stopped command output plugin")
 	return nil
 }
 
@@ -129,16 +131,16 @@ func (o *Command) runCommand() {
 		if err != nil {
 			var ee *exec.ExitError
 			if errors.As(err, &ee) {
-				log.Printf("command %v exited with code %d", o.command, ee.ExitCode())
+				o.logger.Warn("command exited with non-zero code", "attempt", i+1, "code", ee.ExitCode())
 			} else {
-				log.Printf("command %v run error: %v", o.command, err)
+				o.logger.Error("command run error", "attempt", i+1, "err", err)
 			}
 		} else {
-			log.Printf("command %v succeeded", o.command)
+			o.logger.Info("command succeeded", "attempt", i+1)
 			return
 		}
 	}
-	log.Printf("command %v all attempts failed!", o.command)
+	o.logger.Error("command all attempts failed!", "attempts", o.retries)
 }
 
 func (o *Command) runCommandAttempt() error {
@@ -158,28 +160,26 @@ func (o *Command) runCommandAttempt() error {
 	}
 	cmd.Stdin = &stdinBuf
 
-	stdout := newOutputForwarder("stdout", o.command)
+	stdout := newOutputForwarder(o.logger.With("stream", "stdout"))
 	defer stdout.Close()
 	cmd.Stdout = stdout
 
-	stderr := newOutputForwarder("stderr", o.command)
+	stderr := newOutputForwarder(o.logger.With("stream", "stderr"))
 	defer stderr.Close()
 	cmd.Stderr = stderr
 
-	log.Printf("starting sync command %v...", o.command)
+	o.logger.Info("starting sync command...")
 	return cmd.Run()
 }
 
 type outputForwarder struct {
-	name    string
-	command []string
-	buf     []byte
+	logger *slog.Logger
+	buf    []byte
 }
 
-func newOutputForwarder(name string, command []string) *outputForwarder {
+func newOutputForwarder(logger *slog.Logger) *outputForwarder {
 	return &outputForwarder{
-		name:    name,
-		command: command,
+		logger: logger,
 	}
 }
 
@@ -195,10 +195,10 @@ func (of *outputForwarder) Write(p []byte) (int, error) {
 	for i := bytes.IndexByte(p, '\n'); i >= 0; i = bytes.IndexByte(p, '\n') {
 		yield := dropCR(p[:i])
 		if len(of.buf) > 0 {
-			log.Printf("command %v %s: %s%s", of.command, of.name, of.buf, yield)
+			of.logger.Info("command output", "line", string(of.buf)+string(yield))
 			of.buf = nil
 		} else {
-			log.Printf("command %v %s: %s", of.command, of.name, yield)
+			of.logger.Info("command output", "line", string(yield))
 		}
 		p = p[i+1:]
 	}
@@ -211,7 +211,7 @@ func (of *outputForwarder) Write(p []byte) (int, error) {
 
 func (of *outputForwarder) Close() error {
 	if len(of.buf) > 0 {
-		log.Printf("command %v %s: %s", of.command, of.name, of.buf)
+		of.logger.Info("command output", "line", string(of.buf))
 		of.buf = nil
 	}
 	return nil
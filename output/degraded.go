@@ -0,0 +1,57 @@
+package output
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+type DegradedPolicy int
+
+const (
+	DegradedPublish DegradedPolicy = iota
+	DegradedFallback
+	DegradedRefuse
+)
+
+var degradedPolicyNames = map[DegradedPolicy]string{
+	DegradedPublish:  "publish",
+	DegradedFallback: "fallback",
+	DegradedRefuse:   "refuse",
+}
+
+func (p DegradedPolicy) String() string {
+	if name, ok := degradedPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("DegradedPolicy(%d)", int(p))
+}
+
+func (p *DegradedPolicy) UnmarshalYAML(value *yaml.Node) error {
+	var name string
+	if err := value.Decode(&name); err != nil {
+		return err
+	}
+	for policy, policyName := range degradedPolicyNames {
+		if name == policyName {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown degraded group policy %q", name)
+}
+
+func (p DegradedPolicy) MarshalYAML() (interface{}, error) {
+	return p.String(), nil
+}
+
+func (p DegradedPolicy) JSONSchema() map[string]interface{} {
+	names := make([]string, 0, len(degradedPolicyNames))
+	for policy := DegradedPublish; policy <= DegradedRefuse; policy++ {
+		names = append(names, degradedPolicyNames[policy])
+	}
+	return map[string]interface{}{
+		"type": "string",
+		"enum": names,
+	}
+}
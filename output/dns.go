@@ -1,61 +1,269 @@
 package output
 
 import (
+	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
-	"pgregory.net/rand"
 
 	"github.com/SenseUnit/rgap/config"
 	"github.com/SenseUnit/rgap/iface"
 	"github.com/SenseUnit/rgap/util"
 )
 
+const dnsAdvertisedUDPSize = 1232
+
 type DNSMapping struct {
 	Group             uint64
-	FallbackAddresses []util.IPAddr `yaml:"fallback_addresses"`
+	FallbackAddresses []util.IPAddr  `yaml:"fallback_addresses"`
+	OnDegraded        DegradedPolicy `yaml:"on_degraded"`
+	Services          []DNSServiceConfig
+	MaxAnswers        int           `yaml:"max_answers"`
+	TTLMin            time.Duration `yaml:"ttl_min"`
+	TTLMax            time.Duration `yaml:"ttl_max"`
+	Order             DNSOrder
+	Weights           []DNSWeight
+	Topology          []DNSTopologyRule
+}
+
+// dnsMapping is a DNSMapping prepared for serving.
+type dnsMapping struct {
+	DNSMapping
+	weights []DNSWeight
+}
+
+func newDNSMapping(m DNSMapping) (*dnsMapping, error) {
+	if m.MaxAnswers < 0 {
+		return nil, fmt.Errorf("max_answers can't be negative")
+	}
+	if m.TTLMax > 0 && m.TTLMin > m.TTLMax {
+		return nil, fmt.Errorf("ttl_min is greater than ttl_max")
+	}
+	if m.OnDegraded == DegradedFallback && len(m.FallbackAddresses) == 0 {
+		return nil, fmt.Errorf("on_degraded is %s, but no fallback_addresses are specified", DegradedFallback)
+	}
+	return &dnsMapping{
+		DNSMapping: m,
+		weights:    sortWeights(m.Weights),
+	}, nil
+}
+
+// dnsTarget is a mapping bound to the group it serves.
+type dnsTarget struct {
+	mapping *dnsMapping
+	group   uint64
+}
+
+type dnsService struct {
+	DNSServiceConfig
+	mapping string
+}
+
+type dnsQuery struct {
+	dom    string
+	name   string
+	qtype  uint16
+	client netip.Addr
+	ecs    *dns.EDNS0_SUBNET
+	// scoped is set when answer depends on client address
+	scoped bool
 }
 
 type DNSServerConfig struct {
-	BindAddress      string `yaml:"bind_address"`
+	BindAddress      util.ExpandableString `yaml:"bind_address"`
 	Mappings         map[string]DNSMapping
 	Compress         bool
 	NonAuthoritative bool `yaml:"non_authoritative"`
+	Zones            map[string]DNSZoneConfig
+	Reverse          []DNSReverseMapping
+	TSIGKeys         map[string]DNSTSIGKey `yaml:"tsig_keys"`
+	TLS              *DNSTLSConfig
+	HTTPS            *DNSHTTPSConfig
+	Forward          *DNSForwardConfig
 }
 
 type DNSServer struct {
-	bridge        iface.GroupBridge
-	bindAddress   string
-	mappings      map[string]DNSMapping
-	compress      bool
-	authoritative bool
-	tcpServer     *dns.Server
-	udpServer     *dns.Server
-	tcpDone       chan struct{}
-	udpDone       chan struct{}
-	rand          *rand.Rand
-}
-
-func NewDNSServer(cfg *config.OutputConfig, bridge iface.GroupBridge) (*DNSServer, error) {
+	bridge         iface.GroupBridge
+	bindAddress    string
+	mappings       map[string]*dnsMapping
+	names          map[string]struct{}
+	services       map[string]dnsService
+	templates      []dnsTemplate
+	wildcards      map[string]*dnsMapping
+	reverse        []dnsReverseMapping
+	zones          []*dnsZone
+	compress       bool
+	authoritative  bool
+	counters       sync.Map
+	tsigKeys       map[string]*tsigKey
+	syncQueue      chan struct{}
+	shutdown       chan struct{}
+	busy           sync.WaitGroup
+	refreshMu      sync.Mutex
+	unsubFns       []func()
+	tcpServer      *dns.Server
+	udpServer      *dns.Server
+	tcpDone        chan struct{}
+	udpDone        chan struct{}
+	tlsCfg         *DNSTLSConfig
+	tlsConfig      *tls.Config
+	tlsServer      *dns.Server
+	tlsDone        chan struct{}
+	httpsCfg       *DNSHTTPSConfig
+	httpsTLSConfig *tls.Config
+	httpsServer    *http.Server
+	httpsDone      chan struct{}
+	forwarder      *dnsForwarder
+	logger         *slog.Logger
+}
+
+func NewDNSServer(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (*DNSServer, error) {
 	var oc DNSServerConfig
 	if err := util.CheckedUnmarshal(&cfg.Spec, &oc); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal DNS output config: %w", err)
 	}
-	mappings := make(map[string]DNSMapping)
-	for name, mapping := range oc.Mappings {
-		name = strings.ToLower(strings.TrimRight(name, "."))
-		mappings[name] = mapping
+	mappings := make(map[string]*dnsMapping)
+	names := make(map[string]struct{})
+	services := make(map[string]dnsService)
+	addName := func(name string) {
+		// name and all of its ancestors exist in DNS tree
+		for labels := dns.SplitDomainName(name); len(labels) > 0; labels = labels[1:] {
+			names[strings.Join(labels, ".")] = struct{}{}
+		}
+	}
+	var templates []dnsTemplate
+	wildcards := make(map[string]*dnsMapping)
+	for name, mappingCfg := range oc.Mappings {
+		name = canonicalDNSName(name)
+		label, parent, _ := strings.Cut(name, ".")
+		exact := !strings.Contains(name, dnsGroupPlaceholder) && !strings.Contains(name, "*")
+		if !exact && len(mappingCfg.Services) > 0 {
+			return nil, fmt.Errorf("DNS output: mapping %q: services are supported only for exact names", name)
+		}
+		mapping, err := newDNSMapping(mappingCfg)
+		if err != nil {
+			return nil, fmt.Errorf("DNS output: mapping %q: %w", name, err)
+		}
+		switch {
+		case strings.Contains(name, dnsGroupPlaceholder):
+			t, err := parseDNSTemplate(name, mapping)
+			if err != nil {
+				return nil, fmt.Errorf("DNS output: %w", err)
+			}
+			templates = append(templates, t)
+			addName(parent)
+		case label == "*":
+			wildcards[parent] = mapping
+			addName(name)
+		case strings.Contains(name, "*"):
+			return nil, fmt.Errorf("DNS output: bad wildcard name %q: asterisk must be the whole first label", name)
+		default:
+			mappings[name] = mapping
+			addName(name)
+		}
+		for _, svc := range mapping.Services {
+			if svc.Service == "" {
+				return nil, fmt.Errorf("DNS output: mapping %q: service name is not specified", name)
+			}
+			svcName := canonicalDNSName(svc.Service) + "." + name
+			if _, ok := services[svcName]; ok {
+				return nil, fmt.Errorf("DNS output: duplicate service name %q", svcName)
+			}
+			services[svcName] = dnsService{
+				DNSServiceConfig: svc,
+				mapping:          name,
+			}
+			addName(svcName)
+		}
+	}
+	for svcName := range services {
+		if _, ok := mappings[svcName]; ok {
+			return nil, fmt.Errorf("DNS output: service name %q clashes with mapping", svcName)
+		}
+	}
+	var reverse []dnsReverseMapping
+	for i, rm := range oc.Reverse {
+		m, err := newReverseMapping(rm)
+		if err != nil {
+			return nil, fmt.Errorf("DNS output: reverse mapping #%d: %w", i, err)
+		}
+		reverse = append(reverse, m)
+	}
+	tsigKeys := make(map[string]*tsigKey)
+	for name, keyCfg := range oc.TSIGKeys {
+		key, err := newTSIGKey(name, keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("DNS output: %w", err)
+		}
+		tsigKeys[key.name] = key
+	}
+	var zones []*dnsZone
+	for name, zoneCfg := range oc.Zones {
+		zone, err := newDNSZone(canonicalDNSName(name), zoneCfg, tsigKeys)
+		if err != nil {
+			return nil, fmt.Errorf("DNS output: %w", err)
+		}
+		zones = append(zones, zone)
+	}
+	var forwarder *dnsForwarder
+	if oc.Forward != nil {
+		var err error
+		forwarder, err = newDNSForwarder(oc.Forward)
+		if err != nil {
+			return nil, fmt.Errorf("DNS output: forward: %w", err)
+		}
+	}
+	var tlsConfig, httpsTLSConfig *tls.Config
+	if oc.TLS != nil {
+		if oc.TLS.BindAddress == "" {
+			return nil, fmt.Errorf("DNS output: tls.bind_address is not specified")
+		}
+		var err error
+		tlsConfig, err = loadDNSCert("DNS over TLS", string(oc.TLS.TLSCert), string(oc.TLS.TLSKey), true)
+		if err != nil {
+			return nil, fmt.Errorf("DNS output: %w", err)
+		}
+	}
+	if oc.HTTPS != nil {
+		if oc.HTTPS.BindAddress == "" {
+			return nil, fmt.Errorf("DNS output: https.bind_address is not specified")
+		}
+		var err error
+		httpsTLSConfig, err = loadDNSCert("DNS over HTTPS", string(oc.HTTPS.TLSCert), string(oc.HTTPS.TLSKey), false)
+		if err != nil {
+			return nil, fmt.Errorf("DNS output: %w", err)
+		}
 	}
 	return &DNSServer{
-		bridge:        bridge,
-		bindAddress:   oc.BindAddress,
-		mappings:      mappings,
-		compress:      oc.Compress,
-		authoritative: !oc.NonAuthoritative,
-		rand:          rand.New(),
+		bridge:         bridge,
+		bindAddress:    string(oc.BindAddress),
+		mappings:       mappings,
+		names:          names,
+		services:       services,
+		templates:      templates,
+		wildcards:      wildcards,
+		reverse:        reverse,
+		zones:          zones,
+		tsigKeys:       tsigKeys,
+		syncQueue:      make(chan struct{}, 1),
+		shutdown:       make(chan struct{}),
+		compress:       oc.Compress,
+		authoritative:  !oc.NonAuthoritative,
+		tlsCfg:         oc.TLS,
+		tlsConfig:      tlsConfig,
+		httpsCfg:       oc.HTTPS,
+		httpsTLSConfig: httpsTLSConfig,
+		forwarder:      forwarder,
+		logger:         logger.With("bind_address", oc.BindAddress),
 	}, nil
 }
 
@@ -73,6 +281,7 @@ func (o *DNSServer) Start() error {
 		Net:               "tcp",
 		Handler:           o,
 		UDPSize:           65536,
+		TsigSecret:        tsigSecrets(o.tsigKeys),
 		NotifyStartedFunc: func() { close(tcpStartupDone) },
 	}
 	o.udpServer = &dns.Server{
@@ -80,6 +289,7 @@ func (o *DNSServer) Start() error {
 		Net:               "udp",
 		Handler:           o,
 		UDPSize:           65536,
+		TsigSecret:        tsigSecrets(o.tsigKeys),
 		NotifyStartedFunc: func() { close(udpStartupDone) },
 	}
 	go func() {
@@ -101,118 +311,282 @@ func (o *DNSServer) Start() error {
 		o.tcpServer.Shutdown()
 		return fmt.Errorf("output DNS server (UDP) startup failed: %w", udpStartupErr)
 	}
-	log.Printf("started DNS server (%s) output plugin", o.bindAddress)
+	if o.tlsCfg != nil {
+		if err := o.startTLS(); err != nil {
+			o.udpServer.Shutdown()
+			o.tcpServer.Shutdown()
+			return err
+		}
+	}
+	if o.httpsCfg != nil {
+		if err := o.startHTTPS(); err != nil {
+			o.stopTransports()
+			o.udpServer.Shutdown()
+			o.tcpServer.Shutdown()
+			return err
+		}
+	}
+	if o.forwarder != nil {
+		o.forwarder.start()
+	}
+	if slices.ContainsFunc(o.zones, func(z *dnsZone) bool { return z.transfer != nil }) {
+		o.busy.Add(1)
+		go func() {
+			defer o.busy.Done()
+			o.syncLoop()
+		}()
+		for _, group := range o.bridge.Groups() {
+			o.unsubFns = append(o.unsubFns,
+				o.bridge.OnJoin(group, func(group uint64, item iface.GroupItem) {
+					o.syncZones()
+				}),
+				o.bridge.OnLeave(group, func(group uint64, item iface.GroupItem) {
+					o.syncZones()
+				}),
+			)
+		}
+		// build initial content, so transfers are served right away
+		for _, zone := range o.zones {
+			if zone.transfer != nil {
+				o.refreshZone(zone)
+			}
+		}
+	}
+	o.logger.Info("started DNS server output plugin")
 	return nil
 }
 
 func (o *DNSServer) Stop() error {
+	for _, unsub := range o.unsubFns {
+		unsub()
+	}
+	close(o.shutdown)
+	o.stopTransports()
 	o.udpServer.Shutdown()
 	o.tcpServer.Shutdown()
-	log.Printf("stopped DNS server (%s) output plugin", o.bindAddress)
+	o.busy.Wait()
+	if o.forwarder != nil {
+		o.forwarder.stop()
+	}
+	o.logger.Info("stopped DNS server output plugin")
 	return nil
 }
 
-func (o *DNSServer) failDNSReq(w dns.ResponseWriter, r *dns.Msg) {
+func (o *DNSServer) newReply(r *dns.Msg, rcode int) *dns.Msg {
 	m := new(dns.Msg)
 	m.Compress = o.compress
-	m.Authoritative = o.authoritative
-	m.SetRcode(r, dns.RcodeServerFailure)
-	w.WriteMsg(m)
+	m.SetRcode(r, rcode)
+	m.Authoritative = o.authoritative && rcode != dns.RcodeRefused
+	return m
 }
 
-func (o *DNSServer) serveEmptyResponse(w dns.ResponseWriter, r *dns.Msg) {
-	m := new(dns.Msg)
-	m.Compress = o.compress
-	m.Authoritative = o.authoritative
-	m.SetReply(r)
-	w.WriteMsg(m)
+func (o *DNSServer) replyRcode(w dns.ResponseWriter, r *dns.Msg, rcode int) {
+	w.WriteMsg(o.newReply(r, rcode))
+}
+
+func (o *DNSServer) findZone(name string) *dnsZone {
+	var (
+		best      *dnsZone
+		bestLabel int
+	)
+	for _, zone := range o.zones {
+		if !zone.contains(name) {
+			continue
+		}
+		if labels := dns.CountLabel(zone.origin()); best == nil || labels > bestLabel {
+			best, bestLabel = zone, labels
+		}
+	}
+	return best
 }
 
 func (o *DNSServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
-	if len(r.Question) == 0 {
-		o.failDNSReq(w, r)
+	if len(r.Question) != 1 {
+		o.replyRcode(w, r, dns.RcodeFormatError)
 		return
 	}
 
-	dom := r.Question[0].Name
-	name := strings.ToLower(strings.TrimRight(dom, "."))
-	qtype := r.Question[0].Qtype
-
-	if r.Question[0].Qclass != dns.ClassINET {
-		o.failDNSReq(w, r)
-		return
+	q := &dnsQuery{
+		dom:    r.Question[0].Name,
+		name:   canonicalDNSName(r.Question[0].Name),
+		qtype:  r.Question[0].Qtype,
+		client: addrFromNetAddr(w.RemoteAddr()),
+		ecs:    clientSubnet(r),
+	}
+	if addr, ok := clientSubnetAddr(q.ecs); ok {
+		q.client = addr
 	}
 
-	log.Printf("DNS req @ %s: Name = %q, QType = %s", o.bindAddress, name, dns.Type(qtype).String())
+	o.logger.Info("DNS request", "name", q.name, "qtype", dns.Type(q.qtype).String(), "client", w.RemoteAddr().String())
 
-	switch qtype {
-	case dns.TypeAAAA, dns.TypeA:
-	default:
-		o.failDNSReq(w, r)
+	if tsigErr := o.tsigError(w, r); tsigErr != dns.RcodeSuccess {
+		o.replyTSIGError(w, r, tsigErr)
 		return
 	}
 
-	mapping, ok := o.mappings[name]
-	if !ok {
-		o.failDNSReq(w, r)
+	if r.Question[0].Qclass != dns.ClassINET {
+		o.replyRcode(w, r, dns.RcodeRefused)
 		return
 	}
 
-	if !o.bridge.GroupReady(mapping.Group) {
-		o.failDNSReq(w, r)
+	if q.qtype == dns.TypeAXFR || q.qtype == dns.TypeIXFR {
+		o.serveTransfer(w, r, q)
 		return
 	}
 
-	m := new(dns.Msg)
-	m.Compress = o.compress
-	m.Authoritative = o.authoritative
-
-	items := o.bridge.ListGroup(mapping.Group)
-	if len(items) == 0 {
-		// group is empty - fallback needed
-		for _, addr := range mapping.FallbackAddresses {
-			netAddr := addr.Addr()
-			switch qtype {
-			case dns.TypeA:
-				if netAddr.Is4() {
-					m.Answer = append(m.Answer, &dns.A{
-						Hdr: dns.RR_Header{Name: dom, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 0},
-						A:   netAddr.AsSlice(),
-					})
-				}
-			case dns.TypeAAAA:
-				if netAddr.Is6() {
-					m.Answer = append(m.Answer, &dns.AAAA{
-						Hdr:  dns.RR_Header{Name: dom, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 0},
-						AAAA: netAddr.AsSlice(),
-					})
-				}
+	zone := o.findZone(q.name)
+	answer, extra, exists, err := o.resolve(q)
+	if err != nil {
+		o.logger.Debug("unable to answer DNS request", "name", q.name, "err", err)
+		o.replyRcode(w, r, dns.RcodeServerFailure)
+		return
+	}
+	if zone != nil {
+		// empty non-terminals are known only inside our zones
+		_, ent := o.names[q.name]
+		exists = exists || ent
+		if q.name == zone.name {
+			exists = true
+			switch q.qtype {
+			case dns.TypeSOA:
+				// serial of transferable zone is bumped by sync loop
+				answer = append(answer, zone.SOA())
+			case dns.TypeNS:
+				answer = append(answer, zone.NS()...)
 			}
 		}
-	} else {
-		now := time.Now()
-		for _, item := range items {
-			netAddr := item.Address().Unmap()
-			ttl := uint32(util.Max(item.ExpiresAt().Sub(now).Seconds(), 0))
-			switch qtype {
-			case dns.TypeA:
-				if netAddr.Is4() {
-					m.Answer = append(m.Answer, &dns.A{
-						Hdr: dns.RR_Header{Name: dom, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
-						A:   netAddr.AsSlice(),
-					})
-				}
-			case dns.TypeAAAA:
-				if netAddr.Is6() {
-					m.Answer = append(m.Answer, &dns.AAAA{
-						Hdr:  dns.RR_Header{Name: dom, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl},
-						AAAA: netAddr.AsSlice(),
-					})
-				}
+	}
+
+	switch {
+	case !exists && zone == nil && o.forwarder != nil:
+		o.serveForward(w, r, q)
+	case !exists && zone == nil:
+		o.replyRcode(w, r, dns.RcodeRefused)
+	case !exists:
+		m := o.newReply(r, dns.RcodeNameError)
+		m.Ns = []dns.RR{zone.NegativeSOA()}
+		o.writeReply(w, r, m, q)
+	default:
+		m := o.newReply(r, dns.RcodeSuccess)
+		m.Answer = answer
+		m.Extra = extra
+		if len(answer) == 0 && zone != nil {
+			m.Ns = []dns.RR{zone.NegativeSOA()}
+		}
+		o.writeReply(w, r, m, q)
+	}
+}
+
+// writeReply sends response, adding EDNS0 OPT record if request had one
+// and truncating UDP responses which don't fit into client buffer.
+func (o *DNSServer) writeReply(w dns.ResponseWriter, r, m *dns.Msg, q *dnsQuery) {
+	size := dns.MinMsgSize
+	if opt := r.IsEdns0(); opt != nil {
+		size = max(int(opt.UDPSize()), dns.MinMsgSize)
+		m.SetEdns0(dnsAdvertisedUDPSize, opt.Do())
+		if q.ecs != nil {
+			ecs := *q.ecs
+			ecs.SourceScope = 0
+			if q.scoped {
+				ecs.SourceScope = ecs.SourceNetmask
 			}
+			respOpt := m.IsEdns0()
+			respOpt.Option = append(respOpt.Option, &ecs)
 		}
 	}
-	rand.ShuffleSlice(o.rand, m.Answer)
-	m.SetReply(r)
+	tsig := r.IsTsig()
+	signed := tsig != nil && w.TsigStatus() == nil
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		m.Truncate(size)
+		if signed {
+			truncateForTSIG(m, size-tsigSize(tsig))
+		}
+	}
+	if signed {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	}
 	w.WriteMsg(m)
 }
+
+// resolve returns answer and additional records for the name. exists
+// reports whether name is present in DNS tree at all.
+func (o *DNSServer) resolve(q *dnsQuery) (answer, extra []dns.RR, exists bool, err error) {
+	if mapping, ok := o.mappings[q.name]; ok {
+		answer, err := o.mappingRecords(q, dnsTarget{mapping, mapping.Group})
+		return answer, nil, true, err
+	}
+
+	if svc, ok := o.services[q.name]; ok {
+		if q.qtype != dns.TypeSRV {
+			return nil, nil, true, nil
+		}
+		mapping := o.mappings[svc.mapping]
+		members, err := o.selectMembers(q, dnsTarget{mapping, mapping.Group})
+		if err != nil {
+			return nil, nil, true, err
+		}
+		mappingDom := q.dom[len(q.dom)-len(dns.Fqdn(svc.mapping)):]
+		for _, member := range members {
+			srv := member.SRV(q.dom, mappingDom, svc.DNSServiceConfig)
+			answer = append(answer, srv)
+			extra = append(extra, addressRR(srv.Target, addressType(member.addr), member.addr, member.ttl))
+		}
+		return answer, extra, true, nil
+	}
+
+	if len(o.reverse) > 0 && isReverseName(q.name) {
+		answer, exists, err := o.resolveReverse(q.dom, q.name, q.qtype)
+		return answer, nil, exists, err
+	}
+
+	// per-member name: <dashed IP or index>.<mapped name>
+	label, parent, _ := strings.Cut(q.name, ".")
+	if target, ok := o.lookupMapping(parent); ok {
+		member, found, err := o.lookupMember(target, label)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if found {
+			return memberRecords(q.dom, q.qtype, []dnsMember{member}), nil, true, nil
+		}
+	}
+
+	if target, ok := o.lookupMapping(q.name); ok {
+		answer, err := o.mappingRecords(q, target)
+		return answer, nil, true, err
+	}
+
+	return nil, nil, false, nil
+}
+
+func (o *DNSServer) mappingRecords(q *dnsQuery, target dnsTarget) ([]dns.RR, error) {
+	switch q.qtype {
+	case dns.TypeA, dns.TypeAAAA, dns.TypeTXT:
+		members, err := o.selectMembers(q, target)
+		if err != nil {
+			return nil, err
+		}
+		return memberRecords(q.dom, q.qtype, members), nil
+	}
+	return nil, nil
+}
+
+// counter returns round-robin counter of the target.
+func (o *DNSServer) counter(target dnsTarget) *atomic.Uint64 {
+	counter, _ := o.counters.LoadOrStore(target, new(atomic.Uint64))
+	return counter.(*atomic.Uint64)
+}
+
+func addrFromNetAddr(addr net.Addr) netip.Addr {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.AddrPort().Addr().Unmap()
+	case *net.TCPAddr:
+		return a.AddrPort().Addr().Unmap()
+	}
+	return netip.Addr{}
+}
+
+func canonicalDNSName(name string) string {
+	return strings.ToLower(strings.TrimRight(name, "."))
+}
@@ -0,0 +1,917 @@
+package output
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testResponseWriter captures response of DNSServer.ServeDNS.
+type testResponseWriter struct {
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (w *testResponseWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+
+func (w *testResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
+func (w *testResponseWriter) WriteMsg(m *dns.Msg) error {
+	// pack and unpack response like it happens on the wire
+	wire, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	w.msg = new(dns.Msg)
+	return w.msg.Unpack(wire)
+}
+
+func (w *testResponseWriter) Write(b []byte) (int, error) {
+	w.msg = new(dns.Msg)
+	return len(b), w.msg.Unpack(b)
+}
+
+func (w *testResponseWriter) Close() error        { return nil }
+func (w *testResponseWriter) TsigStatus() error   { return nil }
+func (w *testResponseWriter) TsigTimersOnly(bool) {}
+func (w *testResponseWriter) Hijack()             {}
+
+var (
+	testUDPClient = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 5353}
+	testTCPClient = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 5353}
+)
+
+func testDNSServer(t *testing.T, bridge *testBridge, spec string) *DNSServer {
+	t.Helper()
+	o, err := NewDNSServer(testOutputConfig(t, "kind: dns\nspec:\n"+spec), bridge, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func testExchange(t *testing.T, o *DNSServer, remote net.Addr, r *dns.Msg) *dns.Msg {
+	t.Helper()
+	w := &testResponseWriter{remote: remote}
+	o.ServeDNS(w, r)
+	if w.msg == nil {
+		t.Fatalf("no response to %v", r.Question)
+	}
+	return w.msg
+}
+
+func testQuery(t *testing.T, o *DNSServer, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+	r := new(dns.Msg)
+	r.SetQuestion(dns.Fqdn(name), qtype)
+	return testExchange(t, o, testUDPClient, r)
+}
+
+// rrStrings formats records without TTLs in sorted order, as most of
+// answers are shuffled and TTLs depend on time until expiration.
+func rrStrings(rrs []dns.RR) []string {
+	res := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		cp := dns.Copy(rr)
+		cp.Header().Ttl = 0
+		res = append(res, strings.ReplaceAll(cp.String(), "\t", " "))
+	}
+	slices.Sort(res)
+	return res
+}
+
+type dnsTestCase struct {
+	name   string
+	qname  string
+	qtype  uint16
+	rcode  int
+	answer []string
+	ns     []string
+	extra  []string
+}
+
+func runDNSTests(t *testing.T, o *DNSServer, cases []dnsTestCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := testQuery(t, o, tc.qname, tc.qtype)
+			if m.Rcode != tc.rcode {
+				t.Fatalf("rcode %s, expected %s", dns.RcodeToString[m.Rcode], dns.RcodeToString[tc.rcode])
+			}
+			for _, section := range []struct {
+				name     string
+				actual   []dns.RR
+				expected []string
+			}{
+				{"answer", m.Answer, tc.answer},
+				{"authority", m.Ns, tc.ns},
+				{"additional", m.Extra, tc.extra},
+			} {
+				expected := slices.Clone(section.expected)
+				slices.Sort(expected)
+				if actual := rrStrings(section.actual); !slices.Equal(actual, expected) {
+					t.Errorf("%s section %q, expected %q", section.name, actual, expected)
+				}
+			}
+		})
+	}
+}
+
+const testZoneSOA = "example.com. 0 IN SOA ns1.example.com. hostmaster.example.com. 100 3600 600 604800 10"
+
+func TestDNSZone(t *testing.T) {
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1")}
+	o := testDNSServer(t, bridge, `
+  bind_address: 127.0.0.1:0
+  mappings:
+    worker.example.com:
+      group: 1000
+    deep.ent.example.com:
+      group: 1000
+    outside.example.org:
+      group: 1000
+  zones:
+    example.com:
+      ns: [ns1.example.com, ns2.example.com]
+      serial: 100
+      ttl: 1h
+      negative_ttl: 10s
+`)
+	runDNSTests(t, o, []dnsTestCase{
+		{"mapped name", "worker.example.com", dns.TypeA, dns.RcodeSuccess,
+			[]string{"worker.example.com. 0 IN A 10.0.0.1"}, nil, nil},
+		{"case insensitive name", "WORKER.Example.COM", dns.TypeA, dns.RcodeSuccess,
+			[]string{"WORKER.Example.COM. 0 IN A 10.0.0.1"}, nil, nil},
+		{"nodata", "worker.example.com", dns.TypeMX, dns.RcodeSuccess,
+			nil, []string{testZoneSOA}, nil},
+		{"no addresses of family", "worker.example.com", dns.TypeAAAA, dns.RcodeSuccess,
+			nil, []string{testZoneSOA}, nil},
+		{"nxdomain", "missing.example.com", dns.TypeA, dns.RcodeNameError,
+			nil, []string{testZoneSOA}, nil},
+		{"below mapped name", "sub.worker.example.com", dns.TypeA, dns.RcodeNameError,
+			nil, []string{testZoneSOA}, nil},
+		{"empty non-terminal", "ent.example.com", dns.TypeA, dns.RcodeSuccess,
+			nil, []string{testZoneSOA}, nil},
+		{"apex SOA", "example.com", dns.TypeSOA, dns.RcodeSuccess,
+			[]string{testZoneSOA}, nil, nil},
+		{"apex NS", "example.com", dns.TypeNS, dns.RcodeSuccess,
+			[]string{"example.com. 0 IN NS ns1.example.com.", "example.com. 0 IN NS ns2.example.com."}, nil, nil},
+		{"apex nodata", "example.com", dns.TypeA, dns.RcodeSuccess,
+			nil, []string{testZoneSOA}, nil},
+		{"mapped name outside zones", "outside.example.org", dns.TypeA, dns.RcodeSuccess,
+			[]string{"outside.example.org. 0 IN A 10.0.0.1"}, nil, nil},
+		{"nodata outside zones", "outside.example.org", dns.TypeMX, dns.RcodeSuccess,
+			nil, nil, nil},
+		{"unknown name outside zones", "example.net", dns.TypeA, dns.RcodeRefused,
+			nil, nil, nil},
+		{"parent of mapped name outside zones", "example.org", dns.TypeA, dns.RcodeRefused,
+			nil, nil, nil},
+	})
+
+	t.Run("negative answer TTL", func(t *testing.T) {
+		for _, name := range []string{"missing.example.com", "worker.example.com"} {
+			m := testQuery(t, o, name, dns.TypeMX)
+			if len(m.Ns) != 1 || m.Ns[0].Header().Ttl != 10 {
+				t.Errorf("%s: authority %v, expected SOA with TTL capped by negative TTL", name, m.Ns)
+			}
+			if !m.Authoritative {
+				t.Errorf("%s: negative answer is not authoritative", name)
+			}
+		}
+		if m := testQuery(t, o, "example.com", dns.TypeSOA); m.Answer[0].Header().Ttl != 3600 {
+			t.Errorf("SOA TTL %d, expected zone TTL", m.Answer[0].Header().Ttl)
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		if m := testQuery(t, o, "example.net", dns.TypeA); m.Authoritative {
+			t.Error("REFUSED response is authoritative")
+		}
+		r := new(dns.Msg)
+		r.SetQuestion("worker.example.com.", dns.TypeA)
+		r.Question[0].Qclass = dns.ClassCHAOS
+		if m := testExchange(t, o, testUDPClient, r); m.Rcode != dns.RcodeRefused {
+			t.Errorf("CH query answered with %s", dns.RcodeToString[m.Rcode])
+		}
+		r.Question = []dns.Question{r.Question[0], r.Question[0]}
+		r.Question[0].Qclass = dns.ClassINET
+		if m := testExchange(t, o, testUDPClient, r); m.Rcode != dns.RcodeFormatError {
+			t.Errorf("query with two questions answered with %s", dns.RcodeToString[m.Rcode])
+		}
+	})
+}
+
+func TestDNSServices(t *testing.T) {
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("2001:db8::1")}
+	o := testDNSServer(t, bridge, `
+  mappings:
+    worker.example.com:
+      group: 1000
+      services:
+        - service: _http._tcp
+          port: 8080
+          priority: 10
+          weight: 5
+    empty.example.com:
+      group: 1001
+      fallback_addresses: [192.0.2.1]
+  zones:
+    example.com:
+      ns: [ns1.example.com]
+      serial: 100
+      negative_ttl: 10s
+`)
+	runDNSTests(t, o, []dnsTestCase{
+		{"SRV", "_http._tcp.worker.example.com", dns.TypeSRV, dns.RcodeSuccess,
+			[]string{
+				"_http._tcp.worker.example.com. 0 IN SRV 10 5 8080 10-0-0-1.worker.example.com.",
+				"_http._tcp.worker.example.com. 0 IN SRV 10 5 8080 2001-db8--1.worker.example.com.",
+			},
+			nil,
+			[]string{
+				"10-0-0-1.worker.example.com. 0 IN A 10.0.0.1",
+				"2001-db8--1.worker.example.com. 0 IN AAAA 2001:db8::1",
+			}},
+		{"SRV target", "2001-db8--1.worker.example.com", dns.TypeAAAA, dns.RcodeSuccess,
+			[]string{"2001-db8--1.worker.example.com. 0 IN AAAA 2001:db8::1"}, nil, nil},
+		{"service name nodata", "_http._tcp.worker.example.com", dns.TypeA, dns.RcodeSuccess,
+			nil, []string{testZoneSOA}, nil},
+		{"service parent", "_tcp.worker.example.com", dns.TypeSRV, dns.RcodeSuccess,
+			nil, []string{testZoneSOA}, nil},
+		{"unknown service", "_ftp._tcp.worker.example.com", dns.TypeSRV, dns.RcodeNameError,
+			nil, []string{testZoneSOA}, nil},
+		{"fallback TXT", "empty.example.com", dns.TypeTXT, dns.RcodeSuccess,
+			[]string{`empty.example.com. 0 IN TXT "addr=192.0.2.1" "group=1001" "fallback=true"`}, nil, nil},
+	})
+
+	t.Run("member TXT", func(t *testing.T) {
+		m := testQuery(t, o, "worker.example.com", dns.TypeTXT)
+		if len(m.Answer) != 2 {
+			t.Fatalf("answer %v, expected TXT record per member", m.Answer)
+		}
+		for _, rr := range m.Answer {
+			txt := rr.(*dns.TXT).Txt
+			if len(txt) != 4 || !slices.Contains([]string{"addr=10.0.0.1", "addr=2001:db8::1"}, txt[0]) ||
+				txt[1] != "group=1000" || !strings.HasPrefix(txt[2], "expires=") || txt[3] != "flaps=0" {
+				t.Errorf("unexpected TXT record %v", txt)
+			}
+		}
+	})
+
+	for _, spec := range []string{
+		"  mappings:\n    '*.example.com':\n      services: [{service: _http._tcp}]\n",
+		"  mappings:\n    worker.example.com:\n      services: [{port: 80}]\n",
+		"  mappings:\n    worker.example.com:\n      services: [{service: _http._tcp}, {service: _HTTP._tcp}]\n",
+		"  mappings:\n    worker.example.com:\n      services: [{service: _http._tcp}]\n    _http._tcp.worker.example.com: {}\n",
+	} {
+		if _, err := NewDNSServer(testOutputConfig(t, "kind: dns\nspec:\n"+spec), bridge, testLogger); err == nil {
+			t.Errorf("config %q accepted", spec)
+		}
+	}
+}
+
+func TestDNSReverse(t *testing.T) {
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("2001:db8::1")}
+	bridge.members[1001] = []netip.Addr{netip.MustParseAddr("10.0.1.1")}
+	o := testDNSServer(t, bridge, `
+  reverse:
+    - group: 1000
+      hostname: "{ip-dashed}.g{group}.example.com"
+    - group: 1001
+      hostname: "host.example.com"
+  zones:
+    10.in-addr.arpa:
+      ns: [ns1.example.com]
+      serial: 100
+      negative_ttl: 10s
+`)
+	const soa = "10.in-addr.arpa. 0 IN SOA ns1.example.com. hostmaster.10.in-addr.arpa. 100 3600 600 604800 10"
+	runDNSTests(t, o, []dnsTestCase{
+		{"IPv4 PTR", "1.0.0.10.in-addr.arpa", dns.TypePTR, dns.RcodeSuccess,
+			[]string{"1.0.0.10.in-addr.arpa. 0 IN PTR 10-0-0-1.g1000.example.com."}, nil, nil},
+		{"IPv6 PTR", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", dns.TypePTR, dns.RcodeSuccess,
+			[]string{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa. 0 IN PTR 2001-db8--1.g1000.example.com."}, nil, nil},
+		{"static hostname", "1.1.0.10.in-addr.arpa", dns.TypePTR, dns.RcodeSuccess,
+			[]string{"1.1.0.10.in-addr.arpa. 0 IN PTR host.example.com."}, nil, nil},
+		{"other type", "1.0.0.10.in-addr.arpa", dns.TypeA, dns.RcodeSuccess,
+			nil, []string{soa}, nil},
+		{"partial reverse name", "0.0.10.in-addr.arpa", dns.TypePTR, dns.RcodeSuccess,
+			nil, []string{soa}, nil},
+		{"unknown address", "2.0.0.10.in-addr.arpa", dns.TypePTR, dns.RcodeNameError,
+			nil, []string{soa}, nil},
+		{"partial reverse name outside zones", "8.b.d.0.1.0.0.2.ip6.arpa", dns.TypePTR, dns.RcodeSuccess,
+			nil, nil, nil},
+		{"unknown address outside zones", "1.2.0.192.in-addr.arpa", dns.TypePTR, dns.RcodeRefused,
+			nil, nil, nil},
+	})
+
+	t.Run("PTR TTL", func(t *testing.T) {
+		m := testQuery(t, o, "1.0.0.10.in-addr.arpa", dns.TypePTR)
+		if ttl := m.Answer[0].Header().Ttl; ttl < 58 || ttl > 60 {
+			t.Errorf("PTR TTL %d, expected time until member expiration", ttl)
+		}
+	})
+
+	t.Run("group availability", func(t *testing.T) {
+		bridge := newTestBridge()
+		bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1")}
+		bridge.members[1001] = []netip.Addr{netip.MustParseAddr("10.0.1.1")}
+		o := testDNSServer(t, bridge, `
+  reverse:
+    - group: 1000
+      hostname: a.example.com
+      on_degraded: refuse
+    - group: 1001
+      hostname: b.example.com
+      on_degraded: fallback
+      fallback_addresses: [10.0.9.9]
+  zones:
+    10.in-addr.arpa:
+      ns: [ns1.example.com]
+`)
+		check := func(name string, rcode int, ptr ...string) {
+			t.Helper()
+			m := testQuery(t, o, name, dns.TypePTR)
+			var answer []string
+			for _, rr := range m.Answer {
+				answer = append(answer, rr.(*dns.PTR).Ptr)
+			}
+			if m.Rcode != rcode || !slices.Equal(answer, ptr) {
+				t.Errorf("%s: expected %s %v, got %s %v", name, dns.RcodeToString[rcode], ptr, dns.RcodeToString[m.Rcode], answer)
+			}
+		}
+
+		bridge.unready[1000] = true
+		check("1.0.0.10.in-addr.arpa", dns.RcodeServerFailure)
+		check("1.1.0.10.in-addr.arpa", dns.RcodeSuccess, "b.example.com.")
+		if _, err := o.zoneRecords(o.zones[0]); err == nil {
+			t.Error("reverse zone content is built while group is not ready")
+		}
+
+		bridge.unready[1000] = false
+		bridge.degraded[1000] = true
+		check("1.0.0.10.in-addr.arpa", dns.RcodeServerFailure)
+
+		bridge.degraded[1000] = false
+		bridge.degraded[1001] = true
+		check("1.0.0.10.in-addr.arpa", dns.RcodeSuccess, "a.example.com.")
+		check("9.9.0.10.in-addr.arpa", dns.RcodeSuccess, "b.example.com.")
+		check("1.1.0.10.in-addr.arpa", dns.RcodeNameError)
+	})
+
+	for _, hostname := range []string{"{unknown}.example.com", "bad..example.com"} {
+		spec := "  reverse:\n    - group: 1000\n      hostname: \"" + hostname + "\"\n"
+		if _, err := NewDNSServer(testOutputConfig(t, "kind: dns\nspec:\n"+spec), bridge, testLogger); err == nil {
+			t.Errorf("reverse hostname %q accepted", hostname)
+		}
+	}
+	spec := "  reverse:\n    - group: 1000\n      hostname: host.example.com\n      on_degraded: fallback\n"
+	if _, err := NewDNSServer(testOutputConfig(t, "kind: dns\nspec:\n"+spec), bridge, testLogger); err == nil {
+		t.Error("reverse mapping with fallback policy and no fallback addresses accepted")
+	}
+}
+
+func TestDNSNames(t *testing.T) {
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.1")}
+	bridge.members[1001] = []netip.Addr{netip.MustParseAddr("10.0.1.1")}
+	o := testDNSServer(t, bridge, `
+  mappings:
+    worker.example.com:
+      group: 1000
+    '*.svc.example.com':
+      group: 1000
+    exact.svc.example.com:
+      group: 1001
+    x.sub.svc.example.com:
+      group: 1001
+    'g{group}.rgap.example.com': {}
+  zones:
+    example.com:
+      ns: [ns1.example.com]
+      serial: 100
+      negative_ttl: 10s
+`)
+	group1000 := func(name string) []string {
+		return []string{name + ". 0 IN A 10.0.0.1", name + ". 0 IN A 10.0.0.2"}
+	}
+	nxdomain := func(name string) dnsTestCase {
+		return dnsTestCase{name, name, dns.TypeA, dns.RcodeNameError, nil, []string{testZoneSOA}, nil}
+	}
+	runDNSTests(t, o, []dnsTestCase{
+		{"wildcard", "foo.svc.example.com", dns.TypeA, dns.RcodeSuccess,
+			group1000("foo.svc.example.com"), nil, nil},
+		{"wildcard below nonexistent name", "a.b.svc.example.com", dns.TypeA, dns.RcodeSuccess,
+			group1000("a.b.svc.example.com"), nil, nil},
+		{"exact name takes precedence", "exact.svc.example.com", dns.TypeA, dns.RcodeSuccess,
+			[]string{"exact.svc.example.com. 0 IN A 10.0.1.1"}, nil, nil},
+		nxdomain("other.sub.svc.example.com"),
+		{"existing name blocking wildcard", "sub.svc.example.com", dns.TypeA, dns.RcodeSuccess,
+			nil, []string{testZoneSOA}, nil},
+		{"template", "g1001.rgap.example.com", dns.TypeA, dns.RcodeSuccess,
+			[]string{"g1001.rgap.example.com. 0 IN A 10.0.1.1"}, nil, nil},
+		nxdomain("g9999.rgap.example.com"),
+		nxdomain("gx.rgap.example.com"),
+		nxdomain("g.rgap.example.com"),
+		nxdomain("g1000.other.rgap.example.com"),
+		{"template parent", "rgap.example.com", dns.TypeA, dns.RcodeSuccess,
+			nil, []string{testZoneSOA}, nil},
+		{"dashed name", "10-0-0-2.worker.example.com", dns.TypeA, dns.RcodeSuccess,
+			[]string{"10-0-0-2.worker.example.com. 0 IN A 10.0.0.2"}, nil, nil},
+		{"index name", "0.worker.example.com", dns.TypeA, dns.RcodeSuccess,
+			[]string{"0.worker.example.com. 0 IN A 10.0.0.1"}, nil, nil},
+		{"last index name", "1.worker.example.com", dns.TypeA, dns.RcodeSuccess,
+			[]string{"1.worker.example.com. 0 IN A 10.0.0.2"}, nil, nil},
+		nxdomain("2.worker.example.com"),
+		nxdomain("10-0-0-9.worker.example.com"),
+		{"index name of other family", "0.worker.example.com", dns.TypeAAAA, dns.RcodeSuccess,
+			nil, []string{testZoneSOA}, nil},
+		{"dashed name under wildcard", "10-0-0-1.foo.svc.example.com", dns.TypeA, dns.RcodeSuccess,
+			[]string{"10-0-0-1.foo.svc.example.com. 0 IN A 10.0.0.1"}, nil, nil},
+		{"dashed name under template", "10-0-1-1.g1001.rgap.example.com", dns.TypeA, dns.RcodeSuccess,
+			[]string{"10-0-1-1.g1001.rgap.example.com. 0 IN A 10.0.1.1"}, nil, nil},
+	})
+
+	t.Run("index name TXT", func(t *testing.T) {
+		m := testQuery(t, o, "1.worker.example.com", dns.TypeTXT)
+		if len(m.Answer) != 1 || m.Answer[0].(*dns.TXT).Txt[0] != "addr=10.0.0.2" {
+			t.Errorf("answer %v, expected TXT record of second member", m.Answer)
+		}
+	})
+
+	for _, name := range []string{"a*.example.com", "foo.*.example.com", "g{group}{group}.example.com", "x.g{group}.example.com"} {
+		spec := "  mappings:\n    '" + name + "': {}\n"
+		if _, err := NewDNSServer(testOutputConfig(t, "kind: dns\nspec:\n"+spec), bridge, testLogger); err == nil {
+			t.Errorf("mapping name %q accepted", name)
+		}
+	}
+}
+
+func answerAddrs(m *dns.Msg) []string {
+	var res []string
+	for _, rr := range m.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			res = append(res, rr.A.String())
+		case *dns.AAAA:
+			res = append(res, rr.AAAA.String())
+		}
+	}
+	return res
+}
+
+func TestDNSAnswerOrder(t *testing.T) {
+	bridge := newTestBridge()
+	for _, addr := range []string{"10.0.0.3", "10.0.0.1", "10.0.0.4", "10.0.0.2"} {
+		bridge.members[1000] = append(bridge.members[1000], netip.MustParseAddr(addr))
+	}
+	o := testDNSServer(t, bridge, `
+  mappings:
+    random.example.com:
+      group: 1000
+    rr.example.com:
+      group: 1000
+      order: round-robin
+    hash.example.com:
+      group: 1000
+      order: hash
+    weighted.example.com:
+      group: 1000
+      order: weighted
+      weights:
+        - prefix: 10.0.0.0/24
+          weight: 0
+        - prefix: 10.0.0.2
+          weight: 5
+    limited.example.com:
+      group: 1000
+      order: round-robin
+      max_answers: 2
+`)
+	query := func(name string, client net.Addr) []string {
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		return answerAddrs(testExchange(t, o, client, r))
+	}
+
+	t.Run("random", func(t *testing.T) {
+		addrs := query("random.example.com.", testUDPClient)
+		slices.Sort(addrs)
+		if !slices.Equal(addrs, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}) {
+			t.Errorf("answer %v, expected all members", addrs)
+		}
+	})
+
+	t.Run("round-robin", func(t *testing.T) {
+		for i, expected := range [][]string{
+			{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+			{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.1"},
+			{"10.0.0.3", "10.0.0.4", "10.0.0.1", "10.0.0.2"},
+			{"10.0.0.4", "10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		} {
+			if addrs := query("rr.example.com.", testUDPClient); !slices.Equal(addrs, expected) {
+				t.Errorf("query %d: answer %v, expected %v", i, addrs, expected)
+			}
+		}
+	})
+
+	t.Run("max answers", func(t *testing.T) {
+		for i, expected := range [][]string{
+			{"10.0.0.1", "10.0.0.2"},
+			{"10.0.0.2", "10.0.0.3"},
+		} {
+			if addrs := query("limited.example.com.", testUDPClient); !slices.Equal(addrs, expected) {
+				t.Errorf("query %d: answer %v, expected %v", i, addrs, expected)
+			}
+		}
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		orders := make(map[string]bool)
+		for i := 0; i < 32; i++ {
+			client := &net.UDPAddr{IP: net.IPv4(192, 0, 2, byte(i)), Port: 5353}
+			first := query("hash.example.com.", client)
+			if again := query("hash.example.com.", client); !slices.Equal(first, again) {
+				t.Fatalf("client %v got %v and then %v", client, first, again)
+			}
+			orders[strings.Join(first, ",")] = true
+		}
+		if len(orders) < 2 {
+			t.Error("all clients got same order")
+		}
+		// removal of member keeps order of the rest
+		client := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5353}
+		before := query("hash.example.com.", client)
+		bridge.leave(1000, netip.MustParseAddr(before[0]))
+		defer bridge.join(1000, netip.MustParseAddr(before[0]))
+		if after := query("hash.example.com.", client); !slices.Equal(after, before[1:]) {
+			t.Errorf("order %v after removal of first member, expected %v", after, before[1:])
+		}
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		firsts := make(map[string]int)
+		for i := 0; i < 200; i++ {
+			addrs := query("weighted.example.com.", testUDPClient)
+			if len(addrs) != 4 {
+				t.Fatalf("answer %v, expected all members", addrs)
+			}
+			firsts[addrs[0]]++
+		}
+		// only most specific prefix has non-zero weight
+		if firsts["10.0.0.2"] != 200 {
+			t.Errorf("first answers %v, expected only 10.0.0.2", firsts)
+		}
+	})
+
+	for _, spec := range []string{
+		"order: sorted",
+		"max_answers: -1",
+		"{ttl_min: 1m, ttl_max: 10s}",
+	} {
+		doc := "  mappings:\n    worker.example.com: " + spec + "\n"
+		if !strings.HasPrefix(spec, "{") {
+			doc = "  mappings:\n    worker.example.com:\n      " + spec + "\n"
+		}
+		if _, err := NewDNSServer(testOutputConfig(t, "kind: dns\nspec:\n"+doc), bridge, testLogger); err == nil {
+			t.Errorf("mapping setting %q accepted", spec)
+		}
+	}
+}
+
+func TestDNSAnswerTTL(t *testing.T) {
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1")}
+	o := testDNSServer(t, bridge, `
+  mappings:
+    plain.example.com:
+      group: 1000
+    min.example.com:
+      group: 1000
+      ttl_min: 2m
+    max.example.com:
+      group: 1000
+      ttl_max: 10s
+    fallback.example.com:
+      group: 1001
+      fallback_addresses: [192.0.2.1]
+    fallback-min.example.com:
+      group: 1001
+      fallback_addresses: [192.0.2.1]
+      ttl_min: 5s
+`)
+	for name, limits := range map[string][2]uint32{
+		// test members expire in a minute
+		"plain.example.com":        {58, 60},
+		"min.example.com":          {120, 120},
+		"max.example.com":          {10, 10},
+		"fallback.example.com":     {0, 0},
+		"fallback-min.example.com": {5, 5},
+	} {
+		m := testQuery(t, o, name, dns.TypeA)
+		if len(m.Answer) != 1 {
+			t.Errorf("%s: answer %v", name, m.Answer)
+			continue
+		}
+		if ttl := m.Answer[0].Header().Ttl; ttl < limits[0] || ttl > limits[1] {
+			t.Errorf("%s: TTL %d, expected %d..%d", name, ttl, limits[0], limits[1])
+		}
+	}
+}
+
+func TestDNSTruncation(t *testing.T) {
+	bridge := newTestBridge()
+	for i := 1; i <= 40; i++ {
+		bridge.members[1000] = append(bridge.members[1000], netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 15: byte(i)}))
+	}
+	o := testDNSServer(t, bridge, `
+  mappings:
+    worker.example.com:
+      group: 1000
+`)
+	for _, tc := range []struct {
+		name      string
+		remote    net.Addr
+		edns      uint16
+		truncated bool
+	}{
+		{"UDP", testUDPClient, 0, true},
+		{"UDP with small EDNS buffer", testUDPClient, 600, true},
+		{"UDP with large EDNS buffer", testUDPClient, 4096, false},
+		{"TCP", testTCPClient, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := new(dns.Msg)
+			r.SetQuestion("worker.example.com.", dns.TypeAAAA)
+			limit := dns.MinMsgSize
+			if tc.edns > 0 {
+				r.SetEdns0(tc.edns, false)
+				limit = int(tc.edns)
+			}
+			m := testExchange(t, o, tc.remote, r)
+			if m.Truncated != tc.truncated {
+				t.Fatalf("TC bit is %v, expected %v", m.Truncated, tc.truncated)
+			}
+			if tc.truncated {
+				// truncation compresses response when necessary
+				m.Compress = true
+				if len(m.Answer) == 0 || len(m.Answer) >= 40 || m.Len() > limit {
+					t.Errorf("truncated response has %d answers and %d bytes", len(m.Answer), m.Len())
+				}
+			} else if len(m.Answer) != 40 {
+				t.Errorf("response has %d answers, expected all", len(m.Answer))
+			}
+			if (tc.edns > 0) != (m.IsEdns0() != nil) {
+				t.Errorf("response OPT record %v for request EDNS buffer size %d", m.IsEdns0(), tc.edns)
+			}
+		})
+	}
+}
+
+func TestDNSTruncationTSIG(t *testing.T) {
+	bridge := newTestBridge()
+	for i := 1; i <= 40; i++ {
+		bridge.members[1000] = append(bridge.members[1000], netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 15: byte(i)}))
+	}
+	o := testDNSServer(t, bridge, `
+  bind_address: 127.0.0.1:0
+  mappings:
+    worker.example.com:
+      group: 1000
+  tsig_keys:
+    query-key:
+      algorithm: hmac-sha512
+      secret: `+testTSIGSecret+`
+`)
+	if err := o.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Stop()
+
+	// client reads at most 512 bytes without EDNS, so signed response
+	// exceeding it can't be received or verified
+	c := &dns.Client{TsigSecret: map[string]string{"query-key.": testTSIGSecret}}
+	r := new(dns.Msg)
+	r.SetQuestion("worker.example.com.", dns.TypeAAAA)
+	r.SetTsig("query-key.", dns.HmacSHA512, 300, time.Now().Unix())
+	m, _, err := c.Exchange(r, o.udpServer.PacketConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Truncated || len(m.Answer) == 0 || m.IsTsig() == nil {
+		t.Errorf("expected signed truncated response, got tc=%v %d answers tsig=%v", m.Truncated, len(m.Answer), m.IsTsig())
+	}
+}
+
+func TestDNSTSIGErrors(t *testing.T) {
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1")}
+	o := testDNSServer(t, bridge, `
+  bind_address: 127.0.0.1:0
+  mappings:
+    worker.example.com:
+      group: 1000
+  tsig_keys:
+    query-key:
+      secret: `+testTSIGSecret+`
+`)
+	if err := o.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Stop()
+	addr := o.udpServer.PacketConn.LocalAddr().String()
+
+	for _, tc := range []struct {
+		name     string
+		key      string
+		secret   string
+		signedAt time.Time
+		rcode    int
+		tsigErr  uint16
+	}{
+		{"valid signature", "query-key.", testTSIGSecret, time.Now(), dns.RcodeSuccess, dns.RcodeSuccess},
+		{"wrong secret", "query-key.", "d3JvbmdzZWNyZXQ=", time.Now(), dns.RcodeNotAuth, dns.RcodeBadSig},
+		{"unknown key", "other-key.", testTSIGSecret, time.Now(), dns.RcodeNotAuth, dns.RcodeBadKey},
+		{"stale signature", "query-key.", testTSIGSecret, time.Now().Add(-time.Hour), dns.RcodeNotAuth, dns.RcodeBadTime},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &dns.Client{TsigSecret: map[string]string{tc.key: tc.secret}}
+			r := new(dns.Msg)
+			r.SetQuestion("worker.example.com.", dns.TypeA)
+			r.SetTsig(tc.key, dns.HmacSHA256, 300, tc.signedAt.Unix())
+			// verification of error responses fails on client side
+			m, _, err := c.Exchange(r, addr)
+			if m == nil {
+				t.Fatal(err)
+			}
+			if m.Rcode != tc.rcode {
+				t.Errorf("rcode %s, expected %s", dns.RcodeToString[m.Rcode], dns.RcodeToString[tc.rcode])
+			}
+			tsig := m.IsTsig()
+			if tsig == nil {
+				t.Fatal("response has no TSIG record")
+			}
+			if tsig.Error != tc.tsigErr {
+				t.Errorf("TSIG error %s, expected %s", dns.RcodeToString[int(tsig.Error)], dns.RcodeToString[int(tc.tsigErr)])
+			}
+			if tc.rcode == dns.RcodeSuccess && (err != nil || len(m.Answer) != 1) {
+				t.Errorf("unexpected response to valid request: %v %v", m.Answer, err)
+			}
+			if tc.rcode != dns.RcodeSuccess && len(m.Answer) != 0 {
+				t.Errorf("answer %v in response to unauthenticated request", m.Answer)
+			}
+		})
+	}
+}
+
+func TestDNSTopology(t *testing.T) {
+	bridge := newTestBridge()
+	for _, addr := range []string{"10.0.1.1", "10.0.1.2", "10.0.2.1", "10.0.3.1"} {
+		bridge.members[1000] = append(bridge.members[1000], netip.MustParseAddr(addr))
+	}
+	o := testDNSServer(t, bridge, `
+  mappings:
+    geo.example.com:
+      group: 1000
+      topology:
+        - clients: [10.1.0.0/16]
+          prefer: [10.0.1.0/24, 10.0.2.0/24]
+        - clients: [10.1.5.0/24, 2001:db8:5::/48]
+          prefer: [10.0.2.0/24]
+        - clients: [192.0.2.0/24]
+          prefer: [10.0.9.0/24]
+    plain.example.com:
+      group: 1000
+`)
+	all := []string{"10.0.1.1", "10.0.1.2", "10.0.2.1", "10.0.3.1"}
+	for _, tc := range []struct {
+		name     string
+		qname    string
+		client   string
+		ecs      string
+		expected []string
+		scope    uint8
+	}{
+		{"matching client", "geo.example.com", "10.1.1.1", "", []string{"10.0.1.1", "10.0.1.2"}, 0},
+		{"most specific rule", "geo.example.com", "10.1.5.5", "", []string{"10.0.2.1"}, 0},
+		{"no preferred members", "geo.example.com", "192.0.2.53", "", all, 0},
+		{"no matching rule", "geo.example.com", "203.0.113.1", "", all, 0},
+		{"client subnet", "geo.example.com", "203.0.113.1", "10.1.5.0/24", []string{"10.0.2.1"}, 24},
+		{"IPv6 client subnet", "geo.example.com", "203.0.113.1", "2001:db8:5::/56", []string{"10.0.2.1"}, 56},
+		{"client subnet overrides source", "geo.example.com", "10.1.5.5", "198.51.100.0/24", all, 24},
+		{"opted out client subnet", "geo.example.com", "10.1.5.5", "0.0.0.0/0", []string{"10.0.2.1"}, 0},
+		{"client subnet without topology", "plain.example.com", "203.0.113.1", "10.1.5.0/24", all, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := new(dns.Msg)
+			r.SetQuestion(dns.Fqdn(tc.qname), dns.TypeA)
+			var ecs *dns.EDNS0_SUBNET
+			if tc.ecs != "" {
+				prefix := netip.MustParsePrefix(tc.ecs)
+				ecs = &dns.EDNS0_SUBNET{
+					Code:          dns.EDNS0SUBNET,
+					Family:        1,
+					SourceNetmask: uint8(prefix.Bits()),
+					Address:       prefix.Addr().AsSlice(),
+				}
+				if prefix.Addr().Is6() {
+					ecs.Family = 2
+				}
+				r.SetEdns0(dns.DefaultMsgSize, false)
+				r.IsEdns0().Option = append(r.IsEdns0().Option, ecs)
+			}
+			client := netip.MustParseAddr(tc.client)
+			m := testExchange(t, o, &net.UDPAddr{IP: client.AsSlice(), Port: 5353}, r)
+			addrs := answerAddrs(m)
+			slices.Sort(addrs)
+			if !slices.Equal(addrs, tc.expected) {
+				t.Errorf("answer %v, expected %v", addrs, tc.expected)
+			}
+			respECS := clientSubnet(m)
+			if ecs == nil {
+				if respECS != nil {
+					t.Errorf("client subnet %v in response to query without one", respECS)
+				}
+				return
+			}
+			if respECS == nil {
+				t.Fatal("response has no client subnet option")
+			}
+			if respECS.SourceScope != tc.scope || respECS.SourceNetmask != ecs.SourceNetmask ||
+				!net.IP(respECS.Address).Equal(net.IP(ecs.Address)) {
+				t.Errorf("response client subnet %v, expected %v with scope %d", respECS, ecs, tc.scope)
+			}
+		})
+	}
+
+	t.Run("next preferred prefix", func(t *testing.T) {
+		bridge.leave(1000, netip.MustParseAddr("10.0.1.1"))
+		bridge.leave(1000, netip.MustParseAddr("10.0.1.2"))
+		r := new(dns.Msg)
+		r.SetQuestion("geo.example.com.", dns.TypeA)
+		m := testExchange(t, o, &net.UDPAddr{IP: net.IPv4(10, 1, 1, 1), Port: 5353}, r)
+		if addrs := answerAddrs(m); !slices.Equal(addrs, []string{"10.0.2.1"}) {
+			t.Errorf("answer %v, expected members of second preferred prefix", addrs)
+		}
+	})
+}
+
+func TestDNSHashOrderScope(t *testing.T) {
+	bridge := newTestBridge()
+	for _, addr := range []string{"10.0.1.1", "10.0.1.2", "10.0.2.1", "10.0.3.1"} {
+		bridge.members[1000] = append(bridge.members[1000], netip.MustParseAddr(addr))
+	}
+	o := testDNSServer(t, bridge, `
+  mappings:
+    hash.example.com:
+      group: 1000
+      order: hash
+      max_answers: 1
+    plain.example.com:
+      group: 1000
+`)
+	query := func(qname, client string) (string, uint8) {
+		t.Helper()
+		r := new(dns.Msg)
+		r.SetQuestion(qname, dns.TypeA)
+		r.SetEdns0(dns.DefaultMsgSize, false)
+		r.IsEdns0().Option = append(r.IsEdns0().Option, &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        1,
+			SourceNetmask: 24,
+			Address:       net.IPv4(10, 1, 5, 0).To4(),
+		})
+		m := testExchange(t, o, &net.UDPAddr{IP: net.ParseIP(client), Port: 5353}, r)
+		respECS := clientSubnet(m)
+		if respECS == nil {
+			t.Fatal("response has no client subnet option")
+		}
+		return strings.Join(answerAddrs(m), ","), respECS.SourceScope
+	}
+
+	// answer depends on client subnet only, and resolver is told so
+	first, scope := query("hash.example.com.", "203.0.113.1")
+	if scope != 24 {
+		t.Errorf("hash ordered answer has scope %d, expected 24", scope)
+	}
+	if second, _ := query("hash.example.com.", "198.51.100.1"); second != first {
+		t.Errorf("answers %s and %s differ for the same client subnet", first, second)
+	}
+	if _, scope := query("plain.example.com.", "203.0.113.1"); scope != 0 {
+		t.Errorf("answer independent of client has scope %d", scope)
+	}
+}
@@ -0,0 +1,268 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	defaultDNSForwardNet       = "udp"
+	defaultDNSForwardTimeout   = 2 * time.Second
+	defaultDNSForwardCacheSize = 10000
+	defaultDNSForwardMaxTTL    = 1 * time.Hour
+	dnsForwardUDPSize          = 4096
+)
+
+// defaultDNSForwardAllow limits forwarding to loopback and private
+// networks unless allowed clients are configured explicitly, so rgap
+// doesn't become an open resolver by accident.
+var defaultDNSForwardAllow = []util.IPPrefix{
+	util.IPPrefix(netip.MustParsePrefix("127.0.0.0/8")),
+	util.IPPrefix(netip.MustParsePrefix("10.0.0.0/8")),
+	util.IPPrefix(netip.MustParsePrefix("172.16.0.0/12")),
+	util.IPPrefix(netip.MustParsePrefix("192.168.0.0/16")),
+	util.IPPrefix(netip.MustParsePrefix("::1/128")),
+	util.IPPrefix(netip.MustParsePrefix("fc00::/7")),
+}
+
+// DNSForwardConfig configures forwarding of queries for names which are
+// neither mapped nor belong to served zones.
+type DNSForwardConfig struct {
+	Upstreams []util.ExpandableString
+	Net       string
+	Timeout   time.Duration
+	Allow     []util.IPPrefix
+	CacheSize int           `yaml:"cache_size"`
+	MaxTTL    time.Duration `yaml:"max_ttl"`
+}
+
+type dnsCacheKey struct {
+	name  string
+	qtype uint16
+	do    bool
+	cd    bool
+}
+
+type dnsCacheEntry struct {
+	msg    *dns.Msg
+	stored time.Time
+}
+
+type dnsForwarder struct {
+	upstreams []string
+	client    *dns.Client
+	tcpClient *dns.Client
+	allow     []util.IPPrefix
+	maxTTL    time.Duration
+	cache     *ttlcache.Cache[dnsCacheKey, dnsCacheEntry]
+}
+
+func newDNSForwarder(cfg *DNSForwardConfig) (*dnsForwarder, error) {
+	if len(cfg.Upstreams) == 0 {
+		return nil, errors.New("no upstreams specified")
+	}
+	netName := cfg.Net
+	if netName == "" {
+		netName = defaultDNSForwardNet
+	}
+	if netName != "udp" && netName != "tcp" {
+		return nil, fmt.Errorf("unsupported network %q", cfg.Net)
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultDNSForwardTimeout
+	}
+	if cfg.CacheSize < 0 {
+		return nil, errors.New("cache_size can't be negative")
+	}
+	cacheSize := cfg.CacheSize
+	if cacheSize == 0 {
+		cacheSize = defaultDNSForwardCacheSize
+	}
+	allow := cfg.Allow
+	if len(allow) == 0 {
+		allow = defaultDNSForwardAllow
+	}
+	maxTTL := cfg.MaxTTL
+	if maxTTL <= 0 {
+		maxTTL = defaultDNSForwardMaxTTL
+	}
+	f := &dnsForwarder{
+		client: &dns.Client{
+			Net:     netName,
+			Timeout: timeout,
+			UDPSize: dnsForwardUDPSize,
+		},
+		tcpClient: &dns.Client{
+			Net:     "tcp",
+			Timeout: timeout,
+		},
+		allow:  allow,
+		maxTTL: maxTTL,
+		cache: ttlcache.New[dnsCacheKey, dnsCacheEntry](
+			ttlcache.WithCapacity[dnsCacheKey, dnsCacheEntry](uint64(cacheSize)),
+			ttlcache.WithDisableTouchOnHit[dnsCacheKey, dnsCacheEntry](),
+		),
+	}
+	for _, upstream := range util.PlainStrings(cfg.Upstreams) {
+		if _, _, err := net.SplitHostPort(upstream); err != nil {
+			upstream = net.JoinHostPort(upstream, "53")
+		}
+		f.upstreams = append(f.upstreams, upstream)
+	}
+	return f, nil
+}
+
+func (f *dnsForwarder) start() {
+	go f.cache.Start()
+}
+
+func (f *dnsForwarder) stop() {
+	f.cache.Stop()
+}
+
+func (f *dnsForwarder) allowed(w dns.ResponseWriter) bool {
+	client := addrFromNetAddr(w.RemoteAddr())
+	return slices.ContainsFunc(f.allow, func(p util.IPPrefix) bool {
+		return p.Prefix().Contains(client)
+	})
+}
+
+// resolve answers query from cache or from the first upstream which
+// responded. Returned message is a private copy with TTLs adjusted for
+// the time spent in cache.
+func (f *dnsForwarder) resolve(r *dns.Msg) (*dns.Msg, error) {
+	question := r.Question[0]
+	do := false
+	if opt := r.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	key := dnsCacheKey{
+		name:  canonicalDNSName(question.Name),
+		qtype: question.Qtype,
+		do:    do,
+		cd:    r.CheckingDisabled,
+	}
+	if item := f.cache.Get(key); item != nil {
+		entry := item.Value()
+		return agedCopy(entry.msg, time.Since(entry.stored)), nil
+	}
+
+	q := new(dns.Msg)
+	q.SetQuestion(question.Name, question.Qtype)
+	q.CheckingDisabled = r.CheckingDisabled
+	q.SetEdns0(dnsForwardUDPSize, do)
+	var errs []error
+	for _, upstream := range f.upstreams {
+		resp, err := f.exchange(q, upstream)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("upstream %s: %w", upstream, err))
+			continue
+		}
+		if resp.Rcode == dns.RcodeServerFailure || resp.Rcode == dns.RcodeRefused {
+			errs = append(errs, fmt.Errorf("upstream %s: %s", upstream, dns.RcodeToString[resp.Rcode]))
+			continue
+		}
+		resp.Extra = slices.DeleteFunc(resp.Extra, func(rr dns.RR) bool {
+			return rr.Header().Rrtype == dns.TypeOPT
+		})
+		if ttl, ok := cacheTTL(resp); ok {
+			f.cache.Set(key, dnsCacheEntry{msg: resp, stored: time.Now()}, min(ttl, f.maxTTL))
+		}
+		return resp.Copy(), nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (f *dnsForwarder) exchange(q *dns.Msg, upstream string) (*dns.Msg, error) {
+	resp, _, err := f.client.Exchange(q, upstream)
+	if err == nil && resp.Truncated && f.client.Net != "tcp" {
+		resp, _, err = f.tcpClient.Exchange(q, upstream)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Id != q.Id {
+		return nil, errors.New("response ID mismatch")
+	}
+	return resp, nil
+}
+
+// cacheTTL returns time to keep response in cache: lowest TTL of its
+// records or, for negative answers, SOA TTL capped by SOA MINIMUM as
+// described in RFC 2308. Negative answers without SOA are not cached.
+func cacheTTL(m *dns.Msg) (time.Duration, bool) {
+	if m.Truncated || (m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError) {
+		return 0, false
+	}
+	if m.Rcode == dns.RcodeNameError || len(m.Answer) == 0 {
+		for _, rr := range m.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl := min(soa.Hdr.Ttl, soa.Minttl)
+				return time.Duration(ttl) * time.Second, ttl > 0
+			}
+		}
+		return 0, false
+	}
+	ttl := ^uint32(0)
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			ttl = min(ttl, rr.Header().Ttl)
+		}
+	}
+	return time.Duration(ttl) * time.Second, ttl > 0
+}
+
+// agedCopy returns copy of cached message with TTLs decremented by age.
+func agedCopy(m *dns.Msg, age time.Duration) *dns.Msg {
+	res := m.Copy()
+	elapsed := uint32(age / time.Second)
+	for _, section := range [][]dns.RR{res.Answer, res.Ns, res.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Ttl > elapsed {
+				hdr.Ttl -= elapsed
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+	return res
+}
+
+// serveForward answers query for a name unknown to this server using
+// upstream resolvers.
+func (o *DNSServer) serveForward(w dns.ResponseWriter, r *dns.Msg, q *dnsQuery) {
+	if !o.forwarder.allowed(w) {
+		o.replyRcode(w, r, dns.RcodeRefused)
+		return
+	}
+	resp, err := o.forwarder.resolve(r)
+	if err != nil {
+		o.logger.Debug("unable to forward DNS request", "name", q.name, "err", err)
+		m := o.newReply(r, dns.RcodeServerFailure)
+		m.Authoritative = false
+		m.RecursionAvailable = true
+		o.writeReply(w, r, m, q)
+		return
+	}
+	m := new(dns.Msg)
+	m.Compress = o.compress
+	m.SetRcode(r, resp.Rcode)
+	m.RecursionAvailable = true
+	// RFC 6840: AD bit is set only for clients which asked for it
+	m.AuthenticatedData = resp.AuthenticatedData && (r.AuthenticatedData || (r.IsEdns0() != nil && r.IsEdns0().Do()))
+	m.Answer = resp.Answer
+	m.Ns = resp.Ns
+	m.Extra = resp.Extra
+	o.writeReply(w, r, m, q)
+}
@@ -0,0 +1,285 @@
+package output
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+var testPrivateClient = &net.UDPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 5353}
+
+// testUpstream is a fake upstream resolver listening on the same port
+// over UDP and TCP and counting queries by name and network.
+type testUpstream struct {
+	addr    string
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+func newTestUpstream(t *testing.T) *testUpstream {
+	t.Helper()
+	u := &testUpstream{queries: make(map[string]int)}
+	var (
+		pc net.PacketConn
+		l  net.Listener
+	)
+	for attempt := 0; ; attempt++ {
+		var err error
+		pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err = net.Listen("tcp", pc.LocalAddr().String())
+		if err == nil {
+			break
+		}
+		pc.Close()
+		if attempt == 10 {
+			t.Fatal(err)
+		}
+	}
+	u.addr = pc.LocalAddr().String()
+	udpServer := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(u.serve("udp"))}
+	tcpServer := &dns.Server{Listener: l, Handler: dns.HandlerFunc(u.serve("tcp"))}
+	go udpServer.ActivateAndServe()
+	go tcpServer.ActivateAndServe()
+	t.Cleanup(func() {
+		udpServer.Shutdown()
+		tcpServer.Shutdown()
+	})
+	return u
+}
+
+func (u *testUpstream) count(netName, name string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.queries[netName+" "+name]
+}
+
+func (u *testUpstream) serve(netName string) func(dns.ResponseWriter, *dns.Msg) {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		name := r.Question[0].Name
+		u.mu.Lock()
+		u.queries[netName+" "+name]++
+		u.mu.Unlock()
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		soa := func(ttl, minimum uint32) dns.RR {
+			return &dns.SOA{
+				Hdr:    dns.RR_Header{Name: "example.net.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+				Ns:     "ns1.example.net.",
+				Mbox:   "hostmaster.example.net.",
+				Serial: 1, Refresh: 3600, Retry: 600, Expire: 604800,
+				Minttl: minimum,
+			}
+		}
+		a := func(ttl uint32, addr byte) dns.RR {
+			return &dns.A{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+				A:   net.IPv4(192, 0, 2, addr),
+			}
+		}
+		switch name {
+		case "ok.example.net.":
+			m.Answer = []dns.RR{a(300, 1)}
+		case "missing.example.net.":
+			m.Rcode = dns.RcodeNameError
+			m.Ns = []dns.RR{soa(3600, 30)}
+		case "nodata.example.net.":
+			m.Ns = []dns.RR{soa(20, 60)}
+		case "nosoa.example.net.":
+			m.Rcode = dns.RcodeNameError
+		case "large.example.net.":
+			if netName == "udp" {
+				m.Truncated = true
+				break
+			}
+			m.Answer = []dns.RR{a(300, 1), a(300, 2), a(300, 3)}
+		default:
+			m.Rcode = dns.RcodeServerFailure
+		}
+		w.WriteMsg(m)
+	}
+}
+
+func testForwardServer(t *testing.T, u *testUpstream) *DNSServer {
+	t.Helper()
+	o := testDNSServer(t, newTestBridge(), `
+  bind_address: 127.0.0.1:0
+  forward:
+    upstreams: [`+u.addr+`]
+    timeout: 1s
+`)
+	o.forwarder.start()
+	t.Cleanup(o.forwarder.stop)
+	return o
+}
+
+func testForward(t *testing.T, o *DNSServer, name string) *dns.Msg {
+	t.Helper()
+	r := new(dns.Msg)
+	r.SetQuestion(name, dns.TypeA)
+	return testExchange(t, o, testPrivateClient, r)
+}
+
+func TestDNSForwardCache(t *testing.T) {
+	u := newTestUpstream(t)
+	o := testForwardServer(t, u)
+
+	for _, tc := range []struct {
+		name    string
+		rcode   int
+		ttl     time.Duration
+		cached  bool
+		answers int
+	}{
+		{"ok.example.net.", dns.RcodeSuccess, 300 * time.Second, true, 1},
+		// negative answers are cached for SOA MINIMUM or SOA TTL,
+		// whichever is lower
+		{"missing.example.net.", dns.RcodeNameError, 30 * time.Second, true, 0},
+		{"nodata.example.net.", dns.RcodeSuccess, 20 * time.Second, true, 0},
+		{"nosoa.example.net.", dns.RcodeNameError, 0, false, 0},
+		{"fail.example.net.", dns.RcodeServerFailure, 0, false, 0},
+	} {
+		for i := 0; i < 2; i++ {
+			m := testForward(t, o, tc.name)
+			if m.Rcode != tc.rcode {
+				t.Errorf("%s: expected rcode %s, got %s", tc.name, dns.RcodeToString[tc.rcode], dns.RcodeToString[m.Rcode])
+			}
+			if len(m.Answer) != tc.answers {
+				t.Errorf("%s: unexpected answer %v", tc.name, m.Answer)
+			}
+			if !m.RecursionAvailable || m.Authoritative {
+				t.Errorf("%s: unexpected flags ra=%v aa=%v", tc.name, m.RecursionAvailable, m.Authoritative)
+			}
+		}
+		expected := 2
+		if tc.cached {
+			expected = 1
+		}
+		if n := u.count("udp", tc.name); n != expected {
+			t.Errorf("%s: expected %d upstream queries, got %d", tc.name, expected, n)
+		}
+		item := o.forwarder.cache.Get(dnsCacheKey{name: canonicalDNSName(tc.name), qtype: dns.TypeA})
+		switch {
+		case item == nil && tc.cached:
+			t.Errorf("%s: response is not cached", tc.name)
+		case item != nil && !tc.cached:
+			t.Errorf("%s: response is cached", tc.name)
+		case item != nil && item.TTL() != tc.ttl:
+			t.Errorf("%s: expected cache TTL %v, got %v", tc.name, tc.ttl, item.TTL())
+		}
+	}
+}
+
+func TestDNSForwardTTLAging(t *testing.T) {
+	u := newTestUpstream(t)
+	o := testForwardServer(t, u)
+
+	for _, name := range []string{"ok.example.net.", "missing.example.net."} {
+		testForward(t, o, name)
+		// pretend response was stored 100 seconds ago
+		key := dnsCacheKey{name: canonicalDNSName(name), qtype: dns.TypeA}
+		item := o.forwarder.cache.Get(key)
+		if item == nil {
+			t.Fatalf("%s: response is not cached", name)
+		}
+		entry := item.Value()
+		entry.stored = entry.stored.Add(-100 * time.Second)
+		o.forwarder.cache.Set(key, entry, item.TTL())
+
+		m := testForward(t, o, name)
+		if u.count("udp", name) != 1 {
+			t.Errorf("%s: cached response was not used", name)
+		}
+		for _, rr := range append(m.Answer, m.Ns...) {
+			var expected uint32
+			switch rr.Header().Rrtype {
+			case dns.TypeA:
+				expected = 200
+			case dns.TypeSOA:
+				expected = 3500
+			}
+			if rr.Header().Ttl != expected {
+				t.Errorf("%s: expected TTL %d, got %s", name, expected, rr)
+			}
+		}
+	}
+
+	m := new(dns.Msg)
+	m.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "ok.example.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 5},
+		A:   net.IPv4(192, 0, 2, 1),
+	}}
+	if ttl := agedCopy(m, time.Minute).Answer[0].Header().Ttl; ttl != 0 {
+		t.Errorf("expired TTL is not clamped to zero: %d", ttl)
+	}
+	if m.Answer[0].Header().Ttl != 5 {
+		t.Errorf("cached message was modified")
+	}
+}
+
+func TestDNSForwardTruncated(t *testing.T) {
+	u := newTestUpstream(t)
+	o := testForwardServer(t, u)
+
+	m := testForward(t, o, "large.example.net.")
+	if m.Truncated || len(m.Answer) != 3 {
+		t.Errorf("unexpected response to truncated query: tc=%v %v", m.Truncated, m.Answer)
+	}
+	if u.count("udp", "large.example.net.") != 1 || u.count("tcp", "large.example.net.") != 1 {
+		t.Errorf("expected single query over UDP and TCP, got %d and %d",
+			u.count("udp", "large.example.net."), u.count("tcp", "large.example.net."))
+	}
+	// complete response received over TCP is cached
+	testForward(t, o, "large.example.net.")
+	if u.count("tcp", "large.example.net.") != 1 {
+		t.Errorf("response received over TCP is not cached")
+	}
+}
+
+func TestDNSForwardAllow(t *testing.T) {
+	u := newTestUpstream(t)
+	o := testForwardServer(t, u)
+
+	r := new(dns.Msg)
+	r.SetQuestion("ok.example.net.", dns.TypeA)
+	for _, tc := range []struct {
+		client net.Addr
+		rcode  int
+	}{
+		{&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}, dns.RcodeSuccess},
+		{&net.UDPAddr{IP: net.IPv4(172, 20, 0, 1), Port: 5353}, dns.RcodeSuccess},
+		{&net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 5353}, dns.RcodeSuccess},
+		{&net.TCPAddr{IP: net.ParseIP("::ffff:10.0.0.1"), Port: 5353}, dns.RcodeSuccess},
+		{&net.UDPAddr{IP: net.ParseIP("::1"), Port: 5353}, dns.RcodeSuccess},
+		{&net.UDPAddr{IP: net.ParseIP("fd00::1"), Port: 5353}, dns.RcodeSuccess},
+		{testUDPClient, dns.RcodeRefused},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5353}, dns.RcodeRefused},
+	} {
+		if m := testExchange(t, o, tc.client, r); m.Rcode != tc.rcode {
+			t.Errorf("%s: expected rcode %s, got %s", tc.client, dns.RcodeToString[tc.rcode], dns.RcodeToString[m.Rcode])
+		}
+	}
+
+	f, err := newDNSForwarder(&DNSForwardConfig{
+		Upstreams: []util.ExpandableString{util.ExpandableString(u.addr)},
+		Allow:     []util.IPPrefix{util.IPPrefix(netip.MustParsePrefix("192.0.2.0/24"))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.allowed(&testResponseWriter{remote: testUDPClient}) {
+		t.Errorf("explicitly allowed client is refused")
+	}
+	if f.allowed(&testResponseWriter{remote: testPrivateClient}) {
+		t.Errorf("default allowed networks are used despite explicit allow list")
+	}
+}
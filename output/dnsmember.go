@@ -0,0 +1,215 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/iface"
+	"github.com/SenseUnit/rgap/util"
+)
+
+var errDNSGroupUnavailable = errors.New("group is not available")
+
+type DNSServiceConfig struct {
+	Service  string
+	Port     uint16
+	Priority uint16
+	Weight   uint16
+}
+
+// dnsMember is an address served for mapping: either group member or
+// fallback address. Fallback addresses have nil item.
+type dnsMember struct {
+	group uint64
+	addr  netip.Addr
+	ttl   uint32
+	item  iface.GroupItem
+}
+
+// members returns all addresses served for target with TTLs adjusted to
+// mapping limits.
+func (o *DNSServer) members(target dnsTarget) ([]dnsMember, error) {
+	mapping := target.mapping
+	if !o.bridge.GroupReady(target.group) {
+		return nil, errDNSGroupUnavailable
+	}
+
+	var members []dnsMember
+	items := o.bridge.ListGroup(target.group)
+	useFallback := len(items) == 0
+	if o.bridge.GroupDegraded(target.group) {
+		switch mapping.OnDegraded {
+		case DegradedRefuse:
+			return nil, errDNSGroupUnavailable
+		case DegradedFallback:
+			useFallback = true
+		}
+	}
+	if useFallback {
+		// group is empty or degraded - fallback needed
+		for _, addr := range mapping.FallbackAddresses {
+			members = append(members, dnsMember{
+				group: target.group,
+				addr:  addr.Addr().Unmap(),
+			})
+		}
+	} else {
+		now := time.Now()
+		for _, item := range items {
+			members = append(members, dnsMember{
+				group: target.group,
+				addr:  item.Address().Unmap(),
+				ttl:   uint32(util.Max(item.ExpiresAt().Sub(now).Seconds(), 0)),
+				item:  item,
+			})
+		}
+	}
+	for i := range members {
+		if mapping.TTLMax > 0 {
+			members[i].ttl = min(members[i].ttl, uint32(mapping.TTLMax/time.Second))
+		}
+		members[i].ttl = max(members[i].ttl, uint32(mapping.TTLMin/time.Second))
+	}
+	return members, nil
+}
+
+// selectMembers returns members to answer the query with: ones suitable
+// for query type and preferred for the client, ordered and limited
+// according to mapping settings.
+func (o *DNSServer) selectMembers(q *dnsQuery, target dnsTarget) ([]dnsMember, error) {
+	members, err := o.members(target)
+	if err != nil {
+		return nil, err
+	}
+	switch q.qtype {
+	case dns.TypeA:
+		members = slices.DeleteFunc(members, func(m dnsMember) bool { return !m.addr.Is4() })
+	case dns.TypeAAAA:
+		members = slices.DeleteFunc(members, func(m dnsMember) bool { return !m.addr.Is6() })
+	}
+	if len(target.mapping.Topology) > 0 {
+		q.scoped = true
+		members = preferMembers(members, target.mapping.Topology, q.client)
+	}
+	if target.mapping.Order == DNSOrderHash {
+		// order of members is derived from client address
+		q.scoped = true
+	}
+	var counter uint64
+	if target.mapping.Order == DNSOrderRoundRobin {
+		counter = o.counter(target).Add(1) - 1
+	}
+	orderMembers(members, target.mapping.Order, target.mapping.weights, counter, q.client)
+	if target.mapping.MaxAnswers > 0 && len(members) > target.mapping.MaxAnswers {
+		members = members[:target.mapping.MaxAnswers]
+	}
+	return members, nil
+}
+
+// memberRecords returns records of type qtype for owner name dom
+// describing members.
+func memberRecords(dom string, qtype uint16, members []dnsMember) []dns.RR {
+	var res []dns.RR
+	for _, member := range members {
+		var rr dns.RR
+		if qtype == dns.TypeTXT {
+			rr = member.TXT(dom)
+		} else {
+			rr = addressRR(dom, qtype, member.addr, member.ttl)
+		}
+		if rr != nil {
+			res = append(res, rr)
+		}
+	}
+	return res
+}
+
+func (m dnsMember) TXT(dom string) *dns.TXT {
+	txt := []string{
+		"addr=" + m.addr.String(),
+		"group=" + strconv.FormatUint(m.group, 10),
+	}
+	if m.item == nil {
+		txt = append(txt, "fallback=true")
+	} else {
+		txt = append(txt,
+			"expires="+m.item.ExpiresAt().UTC().Format(time.RFC3339),
+			"flaps="+strconv.FormatUint(m.item.Flaps(), 10),
+		)
+	}
+	return &dns.TXT{
+		Hdr: dns.RR_Header{Name: dom, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: m.ttl},
+		Txt: txt,
+	}
+}
+
+func (m dnsMember) SRV(dom, mappingDom string, svc DNSServiceConfig) *dns.SRV {
+	return &dns.SRV{
+		Hdr:      dns.RR_Header{Name: dom, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: m.ttl},
+		Priority: svc.Priority,
+		Weight:   svc.Weight,
+		Port:     svc.Port,
+		Target:   memberName(m.addr, mappingDom),
+	}
+}
+
+// addressType returns type of address record for address.
+func addressType(addr netip.Addr) uint16 {
+	if addr.Is4() {
+		return dns.TypeA
+	}
+	return dns.TypeAAAA
+}
+
+func addressRR(dom string, qtype uint16, addr netip.Addr, ttl uint32) dns.RR {
+	switch {
+	case qtype == dns.TypeA && addr.Is4():
+		return &dns.A{
+			Hdr: dns.RR_Header{Name: dom, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   addr.AsSlice(),
+		}
+	case qtype == dns.TypeAAAA && addr.Is6():
+		return &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: dom, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl},
+			AAAA: addr.AsSlice(),
+		}
+	}
+	return nil
+}
+
+// dashedIP formats address as a single DNS label: dots and colons are
+// replaced with dashes, e.g. 10-0-0-1 or 2001-db8--1.
+func dashedIP(addr netip.Addr) string {
+	s := strings.NewReplacer(".", "-", ":", "-").Replace(addr.Unmap().String())
+	if strings.HasPrefix(s, "-") {
+		s = "0" + s
+	}
+	if strings.HasSuffix(s, "-") {
+		s += "0"
+	}
+	return s
+}
+
+func parseDashedIP(label string) (netip.Addr, error) {
+	if addr, err := netip.ParseAddr(strings.ReplaceAll(label, "-", ".")); err == nil && addr.Is4() {
+		return addr, nil
+	}
+	addr, err := netip.ParseAddr(strings.ReplaceAll(label, "-", ":"))
+	if err != nil || !addr.Is6() {
+		return netip.Addr{}, fmt.Errorf("bad dashed IP address %q", label)
+	}
+	return addr, nil
+}
+
+// memberName returns synthesized name of member of mapping with name
+// mappingDom.
+func memberName(addr netip.Addr, mappingDom string) string {
+	return dashedIP(addr) + "." + dns.Fqdn(mappingDom)
+}
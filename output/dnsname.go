@@ -0,0 +1,106 @@
+package output
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const dnsGroupPlaceholder = "{group}"
+
+// dnsTemplate is a mapping which first label selects the group, e.g.
+// g{group}.rgap.example.com.
+type dnsTemplate struct {
+	prefix  string
+	suffix  string
+	parent  string
+	mapping *dnsMapping
+}
+
+func parseDNSTemplate(name string, mapping *dnsMapping) (dnsTemplate, error) {
+	label, parent, _ := strings.Cut(name, ".")
+	prefix, suffix, ok := strings.Cut(label, dnsGroupPlaceholder)
+	if !ok || strings.Contains(suffix, dnsGroupPlaceholder) || strings.Contains(parent, dnsGroupPlaceholder) {
+		return dnsTemplate{}, fmt.Errorf("bad name template %q: %s placeholder may appear only once in first label", name, dnsGroupPlaceholder)
+	}
+	return dnsTemplate{
+		prefix:  prefix,
+		suffix:  suffix,
+		parent:  parent,
+		mapping: mapping,
+	}, nil
+}
+
+func (t dnsTemplate) match(label string) (uint64, bool) {
+	if len(label) <= len(t.prefix)+len(t.suffix) ||
+		!strings.HasPrefix(label, t.prefix) ||
+		!strings.HasSuffix(label, t.suffix) {
+		return 0, false
+	}
+	group, err := strconv.ParseUint(label[len(t.prefix):len(label)-len(t.suffix)], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return group, true
+}
+
+// lookupMapping finds mapping for the name, trying exact names, then name
+// templates and then wildcards. Like in RFC 4592, wildcard matches only if
+// there is no existing name between it and queried name.
+func (o *DNSServer) lookupMapping(name string) (dnsTarget, bool) {
+	if mapping, ok := o.mappings[name]; ok {
+		return dnsTarget{mapping, mapping.Group}, true
+	}
+	label, parent, _ := strings.Cut(name, ".")
+	for _, t := range o.templates {
+		if t.parent != parent {
+			continue
+		}
+		if group, ok := t.match(label); ok && slices.Contains(o.bridge.Groups(), group) {
+			return dnsTarget{t.mapping, group}, true
+		}
+	}
+	if _, ok := o.names[name]; ok && label != "*" {
+		// existing names are never matched by wildcards
+		return dnsTarget{}, false
+	}
+	for p := parent; ; {
+		if mapping, ok := o.wildcards[p]; ok {
+			return dnsTarget{mapping, mapping.Group}, true
+		}
+		if _, ok := o.names[p]; ok || p == "" {
+			return dnsTarget{}, false
+		}
+		_, p, _ = strings.Cut(p, ".")
+	}
+}
+
+// lookupMember finds member of mapping by per-member name label, which is
+// either dashed IP address or index of member in the list of members
+// sorted by address.
+func (o *DNSServer) lookupMember(target dnsTarget, label string) (dnsMember, bool, error) {
+	index, indexErr := strconv.ParseUint(label, 10, 31)
+	addr, addrErr := parseDashedIP(label)
+	if indexErr != nil && addrErr != nil {
+		return dnsMember{}, false, nil
+	}
+	members, err := o.members(target)
+	if err != nil {
+		return dnsMember{}, false, err
+	}
+	if indexErr == nil {
+		sortByAddress(members)
+		if index < uint64(len(members)) {
+			return members[index], true, nil
+		}
+		return dnsMember{}, false, nil
+	}
+	idx := slices.IndexFunc(members, func(m dnsMember) bool {
+		return m.addr == addr
+	})
+	if idx < 0 {
+		return dnsMember{}, false, nil
+	}
+	return members[idx], true, nil
+}
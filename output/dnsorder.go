@@ -0,0 +1,157 @@
+package output
+
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/netip"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+	"pgregory.net/rand"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+type DNSOrder int
+
+const (
+	DNSOrderRandom DNSOrder = iota
+	DNSOrderRoundRobin
+	DNSOrderHash
+	DNSOrderWeighted
+)
+
+var dnsOrderNames = map[DNSOrder]string{
+	DNSOrderRandom:     "random",
+	DNSOrderRoundRobin: "round-robin",
+	DNSOrderHash:       "hash",
+	DNSOrderWeighted:   "weighted",
+}
+
+func (o DNSOrder) String() string {
+	if name, ok := dnsOrderNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("DNSOrder(%d)", int(o))
+}
+
+func (o *DNSOrder) UnmarshalYAML(value *yaml.Node) error {
+	var name string
+	if err := value.Decode(&name); err != nil {
+		return err
+	}
+	for order, orderName := range dnsOrderNames {
+		if name == orderName {
+			*o = order
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown DNS answer order %q", name)
+}
+
+func (o DNSOrder) MarshalYAML() (interface{}, error) {
+	return o.String(), nil
+}
+
+func (o DNSOrder) JSONSchema() map[string]interface{} {
+	names := make([]string, 0, len(dnsOrderNames))
+	for order := DNSOrderRandom; order <= DNSOrderWeighted; order++ {
+		names = append(names, dnsOrderNames[order])
+	}
+	return map[string]interface{}{
+		"type": "string",
+		"enum": names,
+	}
+}
+
+type DNSWeight struct {
+	Prefix util.IPPrefix
+	Weight uint
+}
+
+// sortWeights orders weights by prefix length, longest first, so first
+// matching entry is the most specific one.
+func sortWeights(weights []DNSWeight) []DNSWeight {
+	res := slices.Clone(weights)
+	slices.SortStableFunc(res, func(a, b DNSWeight) int {
+		return cmp.Compare(b.Prefix.Prefix().Bits(), a.Prefix.Prefix().Bits())
+	})
+	return res
+}
+
+func weightOf(weights []DNSWeight, addr netip.Addr) uint {
+	for _, w := range weights {
+		if w.Prefix.Prefix().Contains(addr) {
+			return w.Weight
+		}
+	}
+	return 1
+}
+
+func sortByAddress(members []dnsMember) {
+	slices.SortFunc(members, func(a, b dnsMember) int {
+		return a.addr.Compare(b.addr)
+	})
+}
+
+// orderMembers reorders members in place according to mapping order.
+// counter is used by round-robin order and client by hash order.
+func orderMembers(members []dnsMember, order DNSOrder, weights []DNSWeight, counter uint64, client netip.Addr) {
+	switch order {
+	case DNSOrderRoundRobin:
+		sortByAddress(members)
+		if len(members) > 0 {
+			shift := int(counter % uint64(len(members)))
+			slices.Reverse(members[:shift])
+			slices.Reverse(members[shift:])
+			slices.Reverse(members)
+		}
+	case DNSOrderHash:
+		// rendezvous hashing: stable for client and mostly stable
+		// across membership changes
+		clientBytes := client.Unmap().AsSlice()
+		scores := make(map[netip.Addr]uint64, len(members))
+		for _, member := range members {
+			h := fnv.New64a()
+			h.Write(clientBytes)
+			h.Write(member.addr.AsSlice())
+			scores[member.addr] = mix64(h.Sum64())
+		}
+		slices.SortFunc(members, func(a, b dnsMember) int {
+			return cmp.Or(
+				cmp.Compare(scores[b.addr], scores[a.addr]),
+				a.addr.Compare(b.addr),
+			)
+		})
+	case DNSOrderWeighted:
+		// weighted random sampling without replacement: each member gets
+		// key -ln(U)/w, members with smaller keys go first
+		keys := make(map[netip.Addr]float64, len(members))
+		for _, member := range members {
+			w := weightOf(weights, member.addr)
+			if w == 0 {
+				keys[member.addr] = math.Inf(1)
+				continue
+			}
+			keys[member.addr] = -math.Log(1-rand.Float64()) / float64(w)
+		}
+		slices.SortFunc(members, func(a, b dnsMember) int {
+			return cmp.Compare(keys[a.addr], keys[b.addr])
+		})
+	default:
+		rand.ShuffleSlice(nil, members)
+	}
+}
+
+// mix64 is a splitmix64 finalizer improving avalanche of FNV hash for
+// similar inputs like adjacent addresses.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
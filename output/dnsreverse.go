@@ -0,0 +1,108 @@
+package output
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+type DNSReverseMapping struct {
+	Group             uint64
+	Hostname          string
+	FallbackAddresses []util.IPAddr  `yaml:"fallback_addresses"`
+	OnDegraded        DegradedPolicy `yaml:"on_degraded"`
+}
+
+// dnsReverseMapping is a DNSReverseMapping prepared for serving. Members
+// are selected by the same rules as for forward mappings.
+type dnsReverseMapping struct {
+	DNSReverseMapping
+	target dnsTarget
+}
+
+func newReverseMapping(rm DNSReverseMapping) (dnsReverseMapping, error) {
+	if err := checkReverseMapping(rm); err != nil {
+		return dnsReverseMapping{}, err
+	}
+	mapping, err := newDNSMapping(DNSMapping{
+		Group:             rm.Group,
+		FallbackAddresses: rm.FallbackAddresses,
+		OnDegraded:        rm.OnDegraded,
+	})
+	if err != nil {
+		return dnsReverseMapping{}, err
+	}
+	return dnsReverseMapping{
+		DNSReverseMapping: rm,
+		target:            dnsTarget{mapping, rm.Group},
+	}, nil
+}
+
+// formatReverseHostname expands hostname pattern placeholders for given
+// member address.
+func formatReverseHostname(pattern string, group uint64, addr netip.Addr) string {
+	return dns.Fqdn(strings.NewReplacer(
+		"{ip}", addr.String(),
+		"{ip-dashed}", dashedIP(addr),
+		"{group}", strconv.FormatUint(group, 10),
+	).Replace(pattern))
+}
+
+func checkReverseMapping(m DNSReverseMapping) error {
+	for _, sample := range []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")} {
+		name := formatReverseHostname(m.Hostname, m.Group, sample)
+		if _, ok := dns.IsDomainName(name); !ok || strings.ContainsAny(name, "{}") {
+			return fmt.Errorf("bad reverse hostname pattern %q", m.Hostname)
+		}
+	}
+	return nil
+}
+
+func isReverseName(name string) bool {
+	return dns.IsSubDomain("in-addr.arpa.", dns.Fqdn(name)) || dns.IsSubDomain("ip6.arpa.", dns.Fqdn(name))
+}
+
+// resolveReverse answers queries for names under in-addr.arpa and ip6.arpa
+// using current members of groups having reverse mappings. Partial reverse
+// names of members are reported as existing empty non-terminals. If name
+// is not found, but some of groups are unavailable, error is returned as
+// name might belong to one of them.
+func (o *DNSServer) resolveReverse(dom, name string, qtype uint16) (answer []dns.RR, exists bool, err error) {
+	var unavailable error
+	for _, rm := range o.reverse {
+		members, err := o.members(rm.target)
+		if err != nil {
+			unavailable = err
+			continue
+		}
+		for _, member := range members {
+			revName, _ := dns.ReverseAddr(member.addr.String())
+			revName = canonicalDNSName(revName)
+			if revName == name {
+				exists = true
+				if qtype == dns.TypePTR {
+					answer = append(answer, &dns.PTR{
+						Hdr: dns.RR_Header{
+							Name:   dom,
+							Rrtype: dns.TypePTR,
+							Class:  dns.ClassINET,
+							Ttl:    member.ttl,
+						},
+						Ptr: formatReverseHostname(rm.Hostname, rm.Group, member.addr),
+					})
+				}
+			} else if strings.HasSuffix(revName, "."+name) {
+				exists = true
+			}
+		}
+	}
+	if !exists && unavailable != nil {
+		return nil, false, unavailable
+	}
+	return answer, exists, nil
+}
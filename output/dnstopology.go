@@ -0,0 +1,86 @@
+package output
+
+import (
+	"net/netip"
+	"slices"
+
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+type DNSTopologyRule struct {
+	Clients []util.IPPrefix
+	Prefer  []util.IPPrefix
+}
+
+// matchTopology returns rule with the most specific client prefix
+// containing client address.
+func matchTopology(rules []DNSTopologyRule, client netip.Addr) (DNSTopologyRule, bool) {
+	var (
+		best     DNSTopologyRule
+		bestBits = -1
+	)
+	if !client.IsValid() {
+		return best, false
+	}
+	for _, rule := range rules {
+		for _, prefix := range rule.Clients {
+			if p := prefix.Prefix(); p.Contains(client) && p.Bits() > bestBits {
+				best, bestBits = rule, p.Bits()
+			}
+		}
+	}
+	return best, bestBits >= 0
+}
+
+// preferMembers narrows members down to ones preferred for the client.
+// Prefixes of matching rule are tried in order and first one containing
+// any members wins. Full set is returned if there is no such prefix.
+func preferMembers(members []dnsMember, rules []DNSTopologyRule, client netip.Addr) []dnsMember {
+	rule, ok := matchTopology(rules, client)
+	if !ok {
+		return members
+	}
+	for _, prefix := range rule.Prefer {
+		preferred := slices.DeleteFunc(slices.Clone(members), func(m dnsMember) bool {
+			return !prefix.Prefix().Contains(m.addr)
+		})
+		if len(preferred) > 0 {
+			return preferred
+		}
+	}
+	return members
+}
+
+// clientSubnet returns EDNS Client Subnet option of the request, if any.
+func clientSubnet(r *dns.Msg) *dns.EDNS0_SUBNET {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, option := range opt.Option {
+		if ecs, ok := option.(*dns.EDNS0_SUBNET); ok {
+			return ecs
+		}
+	}
+	return nil
+}
+
+// clientSubnetAddr returns network address of client subnet. Subnets with
+// zero source prefix length are not usable, as client opted out.
+func clientSubnetAddr(ecs *dns.EDNS0_SUBNET) (netip.Addr, bool) {
+	if ecs == nil || ecs.SourceNetmask == 0 {
+		return netip.Addr{}, false
+	}
+	addr, ok := netip.AddrFromSlice(ecs.Address)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	prefix, err := addr.Prefix(int(ecs.SourceNetmask))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return prefix.Addr(), true
+}
@@ -0,0 +1,284 @@
+package output
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	defaultDoHPath     = "/dns-query"
+	dohContentType     = "application/dns-message"
+	dohMaxRequestSize  = 65535
+	dnsTLSReadTimeout  = 10 * time.Second
+	dnsTLSWriteTimeout = 10 * time.Second
+)
+
+// DNSTLSConfig configures DNS over TLS (RFC 7858) listener.
+type DNSTLSConfig struct {
+	BindAddress util.ExpandableString `yaml:"bind_address"`
+	TLSCert     util.ExpandableString `yaml:"tls_cert"`
+	TLSKey      util.ExpandableString `yaml:"tls_key"`
+}
+
+// DNSHTTPSConfig configures DNS over HTTPS (RFC 8484) listener. Plain
+// HTTP is served if no certificate is specified, which is useful behind
+// TLS-terminating proxy.
+type DNSHTTPSConfig struct {
+	BindAddress util.ExpandableString `yaml:"bind_address"`
+	Path        string
+	TLSCert     util.ExpandableString `yaml:"tls_cert"`
+	TLSKey      util.ExpandableString `yaml:"tls_key"`
+}
+
+func loadDNSCert(kind, certFile, keyFile string, required bool) (*tls.Config, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("%s: tls_cert and tls_key must be specified together", kind)
+	}
+	if certFile == "" {
+		if required {
+			return nil, fmt.Errorf("%s: tls_cert and tls_key are not specified", kind)
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to load TLS certificate: %w", kind, err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
+
+func (o *DNSServer) startTLS() error {
+	var startupErr error
+	startupDone := make(chan struct{})
+	o.tlsDone = make(chan struct{})
+	o.tlsServer = &dns.Server{
+		Addr:              string(o.tlsCfg.BindAddress),
+		Net:               "tcp-tls",
+		TLSConfig:         o.tlsConfig,
+		Handler:           o,
+		UDPSize:           65536,
+		ReadTimeout:       dnsTLSReadTimeout,
+		WriteTimeout:      dnsTLSWriteTimeout,
+		TsigSecret:        tsigSecrets(o.tsigKeys),
+		NotifyStartedFunc: func() { close(startupDone) },
+	}
+	go func() {
+		defer close(o.tlsDone)
+		startupErr = o.tlsServer.ListenAndServe()
+	}()
+	select {
+	case <-startupDone:
+	case <-o.tlsDone:
+		return fmt.Errorf("output DNS server (TLS) startup failed: %w", startupErr)
+	}
+	return nil
+}
+
+func (o *DNSServer) startHTTPS() error {
+	path := o.httpsCfg.Path
+	if path == "" {
+		path = defaultDoHPath
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, o.serveDoH)
+	o.httpsServer = &http.Server{
+		Handler:           mux,
+		TLSConfig:         o.httpsTLSConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		ErrorLog:          slog.NewLogLogger(o.logger.Handler(), slog.LevelError),
+	}
+	ln, err := net.Listen("tcp", string(o.httpsCfg.BindAddress))
+	if err != nil {
+		return fmt.Errorf("output DNS server (HTTPS) listen failed: %w", err)
+	}
+	o.httpsDone = make(chan struct{})
+	go func() {
+		defer close(o.httpsDone)
+		var err error
+		if o.httpsTLSConfig != nil {
+			err = o.httpsServer.ServeTLS(ln, "", "")
+		} else {
+			err = o.httpsServer.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			o.logger.Error("DNS over HTTPS server error", "err", err)
+		}
+	}()
+	return nil
+}
+
+func (o *DNSServer) stopTransports() {
+	if o.httpsServer != nil {
+		o.httpsServer.Close()
+		<-o.httpsDone
+	}
+	if o.tlsServer != nil {
+		o.tlsServer.Shutdown()
+		<-o.tlsDone
+	}
+}
+
+func (o *DNSServer) serveDoH(w http.ResponseWriter, r *http.Request) {
+	var (
+		wire []byte
+		err  error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		wire, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil || len(wire) == 0 {
+			http.Error(w, "bad dns parameter", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != dohContentType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		wire, err = io.ReadAll(io.LimitReader(r.Body, dohMaxRequestSize+1))
+		if err != nil {
+			http.Error(w, "unable to read request", http.StatusBadRequest)
+			return
+		}
+		if len(wire) > dohMaxRequestSize {
+			http.Error(w, "request is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(wire); err != nil {
+		http.Error(w, "malformed DNS message", http.StatusBadRequest)
+		return
+	}
+	dw := &dohResponseWriter{
+		local:  dohAddr(r.Context().Value(http.LocalAddrContextKey)),
+		remote: dohAddr(r.RemoteAddr),
+		tsig:   req.IsTsig() != nil,
+	}
+	if len(req.Question) == 1 && (req.Question[0].Qtype == dns.TypeAXFR || req.Question[0].Qtype == dns.TypeIXFR) {
+		// zone transfers are multi-message exchanges
+		o.replyRcode(dw, req, dns.RcodeNotImplemented)
+	} else {
+		o.ServeDNS(dw, req)
+	}
+	if dw.resp == nil {
+		http.Error(w, "no response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", dohContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(dw.resp)))
+	if ttl, ok := dohMaxAge(dw.resp); ok {
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(ttl), 10))
+	}
+	w.Write(dw.resp)
+}
+
+// dohMaxAge returns freshness lifetime of the response as recommended by
+// RFC 8484 section 5.1. Negative answers are not cached longer than SOA
+// MINIMUM of their authority section, like in RFC 2308.
+func dohMaxAge(wire []byte) (uint32, bool) {
+	m := new(dns.Msg)
+	if err := m.Unpack(wire); err != nil {
+		return 0, false
+	}
+	negative := len(m.Answer) == 0
+	found := false
+	var ttl uint32
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			switch rr.Header().Rrtype {
+			case dns.TypeOPT, dns.TypeTSIG:
+				continue
+			}
+			rrTTL := rr.Header().Ttl
+			if soa, ok := rr.(*dns.SOA); ok && negative {
+				rrTTL = min(rrTTL, soa.Minttl)
+			}
+			if !found || rrTTL < ttl {
+				ttl = rrTTL
+			}
+			found = true
+		}
+	}
+	return ttl, found
+}
+
+// dohAddr converts HTTP peer address into TCP address, so replies are not
+// truncated as for UDP transport.
+func dohAddr(v any) net.Addr {
+	switch addr := v.(type) {
+	case net.Addr:
+		if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+			return tcpAddr
+		}
+		return dohAddr(addr.String())
+	case string:
+		if ap, err := netip.ParseAddrPort(addr); err == nil {
+			return net.TCPAddrFromAddrPort(ap)
+		}
+	}
+	return &net.TCPAddr{}
+}
+
+// dohResponseWriter collects single DNS response for DNS over HTTPS.
+type dohResponseWriter struct {
+	local  net.Addr
+	remote net.Addr
+	tsig   bool
+	resp   []byte
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr  { return w.local }
+func (w *dohResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
+func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	wire, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(wire)
+	return err
+}
+
+func (w *dohResponseWriter) Write(b []byte) (int, error) {
+	if w.resp != nil {
+		return 0, errors.New("DNS over HTTPS response is already written")
+	}
+	w.resp = append([]byte(nil), b...)
+	return len(b), nil
+}
+
+// TsigStatus reports failure for signed requests: TSIG is not supported
+// over HTTPS, so such requests are never considered authenticated.
+func (w *dohResponseWriter) TsigStatus() error {
+	if w.tsig {
+		return errors.New("TSIG is not supported over HTTPS")
+	}
+	return nil
+}
+
+func (w *dohResponseWriter) TsigTimersOnly(bool) {}
+func (w *dohResponseWriter) Hijack()             {}
+func (w *dohResponseWriter) Close() error        { return nil }
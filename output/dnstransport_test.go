@@ -0,0 +1,213 @@
+package output
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// testDoH sends DNS query over HTTP and returns unpacked response and its
+// Cache-Control header.
+func testDoH(t *testing.T, url, method, contentType string, r *dns.Msg) (*dns.Msg, string) {
+	t.Helper()
+	wire, err := r.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req *http.Request
+	if method == http.MethodGet {
+		req, err = http.NewRequest(method, url+"?dns="+base64.RawURLEncoding.EncodeToString(wire), nil)
+	} else {
+		req, err = http.NewRequest(method, url, bytes.NewReader(wire))
+		req.Header.Set("Content-Type", contentType)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: unexpected status %d: %s", method, resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != dohContentType {
+		t.Fatalf("%s: unexpected content type %q", method, ct)
+	}
+	m := new(dns.Msg)
+	if err := m.Unpack(body); err != nil {
+		t.Fatal(err)
+	}
+	if m.Id != r.Id {
+		t.Errorf("%s: response id %d does not match query id %d", method, m.Id, r.Id)
+	}
+	return m, resp.Header.Get("Cache-Control")
+}
+
+func TestDNSOverHTTPS(t *testing.T) {
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1")}
+	o := testDNSServer(t, bridge, `
+  bind_address: 127.0.0.1:0
+  mappings:
+    worker.example.com:
+      group: 1000
+  zones:
+    example.com:
+      ns: [ns1.example.com]
+      ttl: 1h
+      negative_ttl: 30s
+`)
+	srv := httptest.NewServer(http.HandlerFunc(o.serveDoH))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		method, contentType string
+	}{
+		{http.MethodGet, ""},
+		{http.MethodPost, dohContentType},
+		{http.MethodPost, dohContentType + "; charset=binary"},
+	} {
+		r := new(dns.Msg)
+		r.SetQuestion("worker.example.com.", dns.TypeA)
+		m, cacheControl := testDoH(t, srv.URL, tc.method, tc.contentType, r)
+		if addrs := answerAddrs(m); len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+			t.Errorf("%s %q: unexpected answer %v", tc.method, tc.contentType, m.Answer)
+		}
+		// address expires in a minute
+		if cacheControl != "max-age=59" && cacheControl != "max-age=60" {
+			t.Errorf("%s %q: unexpected cache control %q", tc.method, tc.contentType, cacheControl)
+		}
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion("missing.example.com.", dns.TypeA)
+	m, cacheControl := testDoH(t, srv.URL, http.MethodGet, "", r)
+	if m.Rcode != dns.RcodeNameError {
+		t.Errorf("unexpected rcode %s", dns.RcodeToString[m.Rcode])
+	}
+	if cacheControl != "max-age=30" {
+		t.Errorf("unexpected negative cache control %q", cacheControl)
+	}
+
+	wire, err := r.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, method, target, contentType string
+		body                              []byte
+		status                            int
+	}{
+		{"missing dns parameter", http.MethodGet, "", "", nil, http.StatusBadRequest},
+		{"bad base64", http.MethodGet, "?dns=!!!", "", nil, http.StatusBadRequest},
+		{"malformed message", http.MethodPost, "", dohContentType, []byte{1, 2, 3}, http.StatusBadRequest},
+		{"wrong content type", http.MethodPost, "", "text/plain", wire, http.StatusUnsupportedMediaType},
+		{"invalid content type", http.MethodPost, "", "application/dns-message; =binary", wire, http.StatusUnsupportedMediaType},
+		{"too large", http.MethodPost, "", dohContentType, make([]byte, dohMaxRequestSize+1), http.StatusRequestEntityTooLarge},
+		{"wrong method", http.MethodPut, "", dohContentType, wire, http.StatusMethodNotAllowed},
+	} {
+		req, err := http.NewRequest(tc.method, srv.URL+tc.target, bytes.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, resp.StatusCode)
+		}
+	}
+
+	r = new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeAXFR)
+	m, _ = testDoH(t, srv.URL, http.MethodPost, dohContentType, r)
+	if m.Rcode != dns.RcodeNotImplemented {
+		t.Errorf("AXFR: unexpected rcode %s", dns.RcodeToString[m.Rcode])
+	}
+
+	r = new(dns.Msg)
+	r.SetQuestion("worker.example.com.", dns.TypeA)
+	r.SetTsig("query-key.", dns.HmacSHA256, 300, 0)
+	m, _ = testDoH(t, srv.URL, http.MethodPost, dohContentType, r)
+	if m.Rcode != dns.RcodeNotAuth || m.IsTsig() == nil || m.IsTsig().Error != dns.RcodeBadKey || len(m.Answer) != 0 {
+		t.Errorf("signed request: unexpected response %v", m)
+	}
+}
+
+func TestDoHMaxAge(t *testing.T) {
+	soa := func(ttl, minimum uint32) dns.RR {
+		return &dns.SOA{
+			Hdr:     dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+			Ns:      "ns1.example.com.",
+			Mbox:    "hostmaster.example.com.",
+			Serial:  1,
+			Minttl:  minimum,
+			Refresh: 3600, Retry: 600, Expire: 604800,
+		}
+	}
+	a := &dns.A{
+		Hdr: dns.RR_Header{Name: "a.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   []byte{10, 0, 0, 1},
+	}
+	for _, tc := range []struct {
+		name   string
+		answer []dns.RR
+		ns     []dns.RR
+		ttl    uint32
+		ok     bool
+	}{
+		{"empty", nil, nil, 0, false},
+		{"positive", []dns.RR{a}, nil, 300, true},
+		{"negative SOA minimum", nil, []dns.RR{soa(3600, 30)}, 30, true},
+		{"negative SOA ttl", nil, []dns.RR{soa(20, 30)}, 20, true},
+		{"SOA minimum ignored for positive", []dns.RR{a}, []dns.RR{soa(3600, 30)}, 300, true},
+	} {
+		m := new(dns.Msg)
+		m.SetQuestion("a.example.com.", dns.TypeA)
+		m.Answer = tc.answer
+		m.Ns = tc.ns
+		m.SetEdns0(1232, false)
+		wire, err := m.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ttl, ok := dohMaxAge(wire)
+		if ttl != tc.ttl || ok != tc.ok {
+			t.Errorf("%s: expected %d %v, got %d %v", tc.name, tc.ttl, tc.ok, ttl, ok)
+		}
+	}
+}
+
+func TestDNSTransportCerts(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	for _, spec := range []string{
+		"  tls:\n    bind_address: 127.0.0.1:0\n",
+		"  tls:\n    bind_address: 127.0.0.1:0\n    tls_cert: " + missing + "\n    tls_key: " + missing + "\n",
+		"  https:\n    bind_address: 127.0.0.1:0\n    tls_cert: " + missing + "\n    tls_key: " + missing + "\n",
+		"  https:\n    bind_address: 127.0.0.1:0\n    tls_cert: " + missing + "\n",
+	} {
+		_, err := NewDNSServer(testOutputConfig(t, "kind: dns\nspec:\n  bind_address: 127.0.0.1:0\n"+spec), newTestBridge(), testLogger)
+		if err == nil || !strings.Contains(err.Error(), "DNS output") {
+			t.Errorf("expected certificate error for:\n%s\ngot %v", spec, err)
+		}
+	}
+}
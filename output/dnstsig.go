@@ -0,0 +1,184 @@
+package output
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	defaultTSIGAlgorithm = "hmac-sha256"
+	tsigFudge            = 300
+)
+
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// tsigMACSizes maps algorithm names to sizes of their MACs in bytes.
+var tsigMACSizes = map[string]int{
+	dns.HmacSHA1:   20,
+	dns.HmacSHA224: 28,
+	dns.HmacSHA256: 32,
+	dns.HmacSHA384: 48,
+	dns.HmacSHA512: 64,
+}
+
+type DNSTSIGKey struct {
+	Algorithm string
+	Secret    util.Secret
+}
+
+// tsigKey is a TSIG key ready for use with miekg/dns: name and algorithm
+// are fully qualified.
+type tsigKey struct {
+	name      string
+	algorithm string
+	secret    string
+}
+
+func newTSIGKey(name string, cfg DNSTSIGKey) (*tsigKey, error) {
+	algName := cfg.Algorithm
+	if algName == "" {
+		algName = defaultTSIGAlgorithm
+	}
+	alg, ok := tsigAlgorithms[algName]
+	if !ok {
+		return nil, fmt.Errorf("TSIG key %q: unsupported algorithm %q", name, algName)
+	}
+	if _, err := base64.StdEncoding.DecodeString(string(cfg.Secret)); err != nil || cfg.Secret == "" {
+		return nil, fmt.Errorf("TSIG key %q: secret must be non-empty base64 string", name)
+	}
+	return &tsigKey{
+		name:      dns.CanonicalName(name),
+		algorithm: alg,
+		secret:    string(cfg.Secret),
+	}, nil
+}
+
+// tsigSecrets returns secrets map for dns.Server and dns.Client.
+func tsigSecrets(keys map[string]*tsigKey) map[string]string {
+	if len(keys) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(keys))
+	for _, key := range keys {
+		res[key.name] = key.secret
+	}
+	return res
+}
+
+// sign adds TSIG record to the message. It is signed on write by
+// dns.Client or dns.ResponseWriter.
+func (k *tsigKey) sign(m *dns.Msg) {
+	m.SetTsig(k.name, k.algorithm, tsigFudge, time.Now().Unix())
+}
+
+// verified reports if request is signed with the key and signature is
+// valid.
+func (k *tsigKey) verified(w dns.ResponseWriter, r *dns.Msg) bool {
+	tsig := r.IsTsig()
+	return tsig != nil &&
+		w.TsigStatus() == nil &&
+		dns.CanonicalName(tsig.Hdr.Name) == k.name &&
+		dns.CanonicalName(tsig.Algorithm) == k.algorithm
+}
+
+// tsigSize returns wire size of TSIG record which signs response to the
+// request signed with tsig.
+func tsigSize(tsig *dns.TSIG) int {
+	macSize, ok := tsigMACSizes[dns.CanonicalName(tsig.Algorithm)]
+	if !ok {
+		macSize = tsigMACSizes[dns.HmacSHA512]
+	}
+	return dns.Len(&dns.TSIG{
+		Hdr:       dns.RR_Header{Name: tsig.Hdr.Name, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+		Algorithm: tsig.Algorithm,
+		MAC:       strings.Repeat("00", macSize),
+	})
+}
+
+// truncateForTSIG drops records from the end of response until it fits
+// into size, making room for TSIG record appended on write. It's needed
+// because dns.Msg.Truncate never truncates below 512 bytes.
+func truncateForTSIG(m *dns.Msg, size int) {
+	if m.Len() <= size {
+		return
+	}
+	m.Compress = true
+	for m.Len() > size {
+		i := len(m.Extra) - 1
+		for i >= 0 && m.Extra[i].Header().Rrtype == dns.TypeOPT {
+			i--
+		}
+		switch {
+		case i >= 0:
+			m.Extra = slices.Delete(m.Extra, i, i+1)
+		case len(m.Ns) > 0:
+			m.Ns = m.Ns[:len(m.Ns)-1]
+		case len(m.Answer) > 0:
+			m.Answer = m.Answer[:len(m.Answer)-1]
+		default:
+			return
+		}
+		m.Truncated = true
+	}
+}
+
+// tsigError returns TSIG error code (RFC 8945 section 5.2) for signed
+// request which can't be authenticated, or zero if request is unsigned or
+// verified.
+func (o *DNSServer) tsigError(w dns.ResponseWriter, r *dns.Msg) uint16 {
+	tsig := r.IsTsig()
+	if tsig == nil {
+		return dns.RcodeSuccess
+	}
+	if _, ok := o.tsigKeys[dns.CanonicalName(tsig.Hdr.Name)]; !ok {
+		return dns.RcodeBadKey
+	}
+	switch err := w.TsigStatus(); {
+	case err == nil:
+		return dns.RcodeSuccess
+	case errors.Is(err, dns.ErrSig):
+		return dns.RcodeBadSig
+	case errors.Is(err, dns.ErrTime):
+		return dns.RcodeBadTime
+	default:
+		return dns.RcodeBadKey
+	}
+}
+
+// replyTSIGError answers request which failed authentication with NOTAUTH
+// and TSIG record carrying the error. Such response is left unsigned,
+// except for BADTIME one, which also reports current server time.
+func (o *DNSServer) replyTSIGError(w dns.ResponseWriter, r *dns.Msg, tsigErr uint16) {
+	tsig := r.IsTsig()
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeNotAuth)
+	now := time.Now().Unix()
+	m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, now)
+	rr := m.IsTsig()
+	rr.OrigId = r.Id
+	rr.Error = tsigErr
+	if tsigErr == dns.RcodeBadTime {
+		rr.TimeSigned = tsig.TimeSigned
+		rr.OtherLen = 6
+		rr.OtherData = hex.EncodeToString([]byte{
+			byte(now >> 40), byte(now >> 32), byte(now >> 24), byte(now >> 16), byte(now >> 8), byte(now),
+		})
+	}
+	o.logger.Warn("DNS request authentication failed", "client", w.RemoteAddr().String(), "key", tsig.Hdr.Name, "error", dns.RcodeToString[int(tsigErr)])
+	w.WriteMsg(m)
+}
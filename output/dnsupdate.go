@@ -0,0 +1,370 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/iface"
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	defaultDNSUpdateNet      = "tcp"
+	defaultDNSUpdateTTL      = 30 * time.Second
+	defaultDNSUpdateInterval = 1 * time.Minute
+	defaultDNSUpdateTimeout  = 5 * time.Second
+	dnsUpdateQueueSize       = 1024
+)
+
+type DNSUpdateTSIG struct {
+	Name      string
+	Algorithm string
+	Secret    util.Secret
+}
+
+type DNSUpdateConfig struct {
+	Server   util.ExpandableString
+	Net      string
+	Zone     string
+	TSIG     *DNSUpdateTSIG
+	TTL      time.Duration
+	Interval time.Duration
+	Timeout  time.Duration
+	Mappings []GroupHostMapping
+}
+
+type dnsUpdateEvent struct {
+	group uint64
+	addr  netip.Addr
+	join  bool
+}
+
+type DNSUpdate struct {
+	bridge    iface.GroupBridge
+	server    string
+	zone      string
+	client    *dns.Client
+	key       *tsigKey
+	ttl       uint32
+	interval  time.Duration
+	mappings  []GroupHostMapping
+	fallback  []bool
+	events    chan dnsUpdateEvent
+	resync    chan struct{}
+	unsubFns  []func()
+	ctx       context.Context
+	ctxCancel func()
+	loopDone  chan struct{}
+	logger    *slog.Logger
+}
+
+func NewDNSUpdate(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (*DNSUpdate, error) {
+	var uc DNSUpdateConfig
+	if err := util.CheckedUnmarshal(&cfg.Spec, &uc); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal dnsupdate output config: %w", err)
+	}
+	if uc.Server == "" {
+		return nil, fmt.Errorf("server is not specified")
+	}
+	if uc.Zone == "" {
+		return nil, fmt.Errorf("zone is not specified")
+	}
+	zone := dns.CanonicalName(uc.Zone)
+	for i, mapping := range uc.Mappings {
+		if mapping.Hostname == "" {
+			return nil, fmt.Errorf("mapping with index %d has no hostname defined", i)
+		}
+		if !dns.IsSubDomain(zone, dns.CanonicalName(mapping.Hostname)) {
+			return nil, fmt.Errorf("mapping with index %d: hostname %q is outside of zone %q", i, mapping.Hostname, uc.Zone)
+		}
+		if mapping.OnDegraded == DegradedFallback && len(mapping.FallbackAddresses) == 0 {
+			return nil, fmt.Errorf("mapping with index %d: on_degraded is %s, but no fallback_addresses are specified", i, DegradedFallback)
+		}
+	}
+	netName := uc.Net
+	if netName == "" {
+		netName = defaultDNSUpdateNet
+	}
+	if netName != "tcp" && netName != "udp" {
+		return nil, fmt.Errorf("unsupported network %q", uc.Net)
+	}
+	timeout := uc.Timeout
+	if timeout <= 0 {
+		timeout = defaultDNSUpdateTimeout
+	}
+	interval := uc.Interval
+	if interval <= 0 {
+		interval = defaultDNSUpdateInterval
+	}
+	client := &dns.Client{
+		Net:     netName,
+		Timeout: timeout,
+	}
+	var key *tsigKey
+	if uc.TSIG != nil {
+		var err error
+		key, err = newTSIGKey(uc.TSIG.Name, DNSTSIGKey{
+			Algorithm: uc.TSIG.Algorithm,
+			Secret:    uc.TSIG.Secret,
+		})
+		if err != nil {
+			return nil, err
+		}
+		client.TsigSecret = tsigSecrets(map[string]*tsigKey{key.name: key})
+	}
+	return &DNSUpdate{
+		bridge:   bridge,
+		server:   string(uc.Server),
+		zone:     zone,
+		client:   client,
+		key:      key,
+		ttl:      durationSeconds(uc.TTL, defaultDNSUpdateTTL),
+		interval: interval,
+		mappings: uc.Mappings,
+		fallback: make([]bool, len(uc.Mappings)),
+		events:   make(chan dnsUpdateEvent, dnsUpdateQueueSize),
+		resync:   make(chan struct{}, 1),
+		logger:   logger.With("server", uc.Server, "zone", zone),
+	}, nil
+}
+
+func (o *DNSUpdate) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	o.ctx = ctx
+	o.ctxCancel = cancel
+	o.loopDone = make(chan struct{})
+	go o.loop()
+	for _, group := range o.groups() {
+		o.unsubFns = append(o.unsubFns,
+			o.bridge.OnJoin(group, func(group uint64, item iface.GroupItem) {
+				o.enqueue(dnsUpdateEvent{group: group, addr: item.Address().Unmap(), join: true})
+			}),
+			o.bridge.OnLeave(group, func(group uint64, item iface.GroupItem) {
+				o.enqueue(dnsUpdateEvent{group: group, addr: item.Address().Unmap(), join: false})
+			}),
+		)
+	}
+	o.logger.Info("started dnsupdate output plugin")
+	return nil
+}
+
+func (o *DNSUpdate) Stop() error {
+	for _, unsub := range o.unsubFns {
+		unsub()
+	}
+	o.ctxCancel()
+	<-o.loopDone
+	o.logger.Info("stopped dnsupdate output plugin")
+	return nil
+}
+
+func (o *DNSUpdate) groups() []uint64 {
+	var groups []uint64
+	for _, mapping := range o.mappings {
+		if !slices.Contains(groups, mapping.Group) {
+			groups = append(groups, mapping.Group)
+		}
+	}
+	return groups
+}
+
+func (o *DNSUpdate) enqueue(ev dnsUpdateEvent) {
+	select {
+	case o.events <- ev:
+	default:
+		// queue overflow, full reconciliation will catch up
+		o.requestResync()
+	}
+}
+
+func (o *DNSUpdate) requestResync() {
+	select {
+	case o.resync <- struct{}{}:
+	default:
+	}
+}
+
+func (o *DNSUpdate) loop() {
+	defer close(o.loopDone)
+	for _, group := range o.groups() {
+		select {
+		case <-o.ctx.Done():
+			return
+		case <-o.bridge.GroupReadinessBarrier(group):
+		}
+	}
+	o.reconcile()
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.ctx.Done():
+			return
+		case <-ticker.C:
+			o.reconcile()
+		case <-o.resync:
+			o.reconcile()
+		case ev := <-o.events:
+			o.apply(ev)
+		}
+	}
+}
+
+// desired returns addresses which should be published for mapping. ok is
+// false if mapping should be left intact.
+func (o *DNSUpdate) desired(mapping GroupHostMapping) (addrs []netip.Addr, fallback bool, ok bool) {
+	if !o.bridge.GroupReady(mapping.Group) {
+		return nil, false, false
+	}
+	degraded := o.bridge.GroupDegraded(mapping.Group)
+	if degraded && mapping.OnDegraded == DegradedRefuse {
+		return nil, false, false
+	}
+	items := o.bridge.ListGroup(mapping.Group)
+	if len(items) == 0 || (degraded && mapping.OnDegraded == DegradedFallback) {
+		for _, addr := range mapping.FallbackAddresses {
+			addrs = append(addrs, addr.Addr().Unmap())
+		}
+		return addrs, true, true
+	}
+	for _, item := range items {
+		addrs = append(addrs, item.Address().Unmap())
+	}
+	return addrs, false, true
+}
+
+// apply publishes single membership change. Full reconciliation is done
+// instead if some of affected mappings switch between group addresses and
+// fallback addresses.
+func (o *DNSUpdate) apply(ev dnsUpdateEvent) {
+	var rrs []dns.RR
+	for i, mapping := range o.mappings {
+		if mapping.Group != ev.group {
+			continue
+		}
+		_, fallback, ok := o.desired(mapping)
+		if !ok {
+			continue
+		}
+		if fallback || o.fallback[i] {
+			o.reconcile()
+			return
+		}
+		if !ev.join && o.publishedElsewhere(i, ev.addr) {
+			continue
+		}
+		rrs = append(rrs, addressRR(dns.Fqdn(mapping.Hostname), addressType(ev.addr), ev.addr, o.ttl))
+	}
+	if len(rrs) == 0 {
+		return
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(o.zone)
+	if ev.join {
+		m.Insert(rrs)
+	} else {
+		m.Remove(rrs)
+	}
+	if err := o.send(m); err != nil {
+		o.logger.Error("dynamic update failed", "address", ev.addr, "join", ev.join, "err", err)
+		o.requestResync()
+		return
+	}
+	o.logger.Debug("dynamic update done", "address", ev.addr, "join", ev.join)
+}
+
+// publishedElsewhere reports whether address has to stay in records of
+// hostname of mapping idx because other mapping of the same hostname
+// still publishes it or is left intact at the moment.
+func (o *DNSUpdate) publishedElsewhere(idx int, addr netip.Addr) bool {
+	name := dns.CanonicalName(o.mappings[idx].Hostname)
+	for i, mapping := range o.mappings {
+		if i == idx || dns.CanonicalName(mapping.Hostname) != name {
+			continue
+		}
+		addrs, _, ok := o.desired(mapping)
+		if !ok || slices.Contains(addrs, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile replaces address records of all mapped hostnames with full
+// set of desired addresses in a single atomic update.
+func (o *DNSUpdate) reconcile() {
+	type hostState struct {
+		addrs []netip.Addr
+		skip  bool
+	}
+	hosts := make(map[string]*hostState)
+	var order []string
+	fallback := slices.Clone(o.fallback)
+	for i, mapping := range o.mappings {
+		name := dns.CanonicalName(mapping.Hostname)
+		host, ok := hosts[name]
+		if !ok {
+			host = new(hostState)
+			hosts[name] = host
+			order = append(order, name)
+		}
+		addrs, isFallback, ok := o.desired(mapping)
+		if !ok {
+			host.skip = true
+			continue
+		}
+		fallback[i] = isFallback
+		host.addrs = append(host.addrs, addrs...)
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(o.zone)
+	for _, name := range order {
+		host := hosts[name]
+		if host.skip {
+			o.logger.Info("skipping update of hostname because some of its groups are not ready or degraded", "hostname", name)
+			continue
+		}
+		m.RemoveRRset([]dns.RR{
+			&dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA}},
+			&dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA}},
+		})
+		var rrs []dns.RR
+		for _, addr := range host.addrs {
+			rrs = append(rrs, addressRR(name, addressType(addr), addr, o.ttl))
+		}
+		if len(rrs) > 0 {
+			m.Insert(rrs)
+		}
+	}
+	if len(m.Ns) == 0 {
+		return
+	}
+	if err := o.send(m); err != nil {
+		o.logger.Error("reconciliation update failed", "err", err)
+		return
+	}
+	o.fallback = fallback
+	o.logger.Debug("reconciliation update done")
+}
+
+func (o *DNSUpdate) send(m *dns.Msg) error {
+	if o.key != nil {
+		o.key.sign(m)
+	}
+	resp, _, err := o.client.ExchangeContext(o.ctx, m, o.server)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("update rejected: %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package output
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/iface"
+)
+
+const testTSIGSecret = "c2VjcmV0c2VjcmV0c2VjcmV0"
+
+type testItem netip.Addr
+
+func (i testItem) Address() netip.Addr  { return netip.Addr(i) }
+func (i testItem) ExpiresAt() time.Time { return time.Now().Add(time.Minute) }
+func (i testItem) Flaps() uint64        { return 0 }
+
+// testBridge is a GroupBridge with manually controlled membership.
+type testBridge struct {
+	mu       sync.Mutex
+	members  map[uint64][]netip.Addr
+	degraded map[uint64]bool
+	unready  map[uint64]bool
+	onJoin   map[uint64][]iface.GroupEventCallback
+	onLeave  map[uint64][]iface.GroupEventCallback
+}
+
+func newTestBridge() *testBridge {
+	return &testBridge{
+		members:  make(map[uint64][]netip.Addr),
+		degraded: make(map[uint64]bool),
+		unready:  make(map[uint64]bool),
+		onJoin:   make(map[uint64][]iface.GroupEventCallback),
+		onLeave:  make(map[uint64][]iface.GroupEventCallback),
+	}
+}
+
+func (b *testBridge) Groups() []uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var res []uint64
+	for group := range b.members {
+		res = append(res, group)
+	}
+	return res
+}
+
+func (b *testBridge) ListGroup(group uint64) []iface.GroupItem {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var res []iface.GroupItem
+	for _, addr := range b.members[group] {
+		res = append(res, testItem(addr))
+	}
+	return res
+}
+
+func (b *testBridge) GroupReady(group uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.unready[group]
+}
+
+func (b *testBridge) GroupDegraded(group uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.degraded[group]
+}
+
+func (b *testBridge) GroupReadinessBarrier(uint64) <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+func (b *testBridge) OnJoin(group uint64, cb iface.GroupEventCallback) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onJoin[group] = append(b.onJoin[group], cb)
+	return func() {}
+}
+
+func (b *testBridge) OnLeave(group uint64, cb iface.GroupEventCallback) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onLeave[group] = append(b.onLeave[group], cb)
+	return func() {}
+}
+
+func (b *testBridge) OnReject(iface.RejectionCallback) func() { return func() {} }
+
+func (b *testBridge) join(group uint64, addr netip.Addr) {
+	b.mu.Lock()
+	b.members[group] = append(b.members[group], addr)
+	cbs := slices.Clone(b.onJoin[group])
+	b.mu.Unlock()
+	for _, cb := range cbs {
+		cb(group, testItem(addr))
+	}
+}
+
+func (b *testBridge) leave(group uint64, addr netip.Addr) {
+	b.mu.Lock()
+	b.members[group] = slices.DeleteFunc(b.members[group], func(a netip.Addr) bool { return a == addr })
+	cbs := slices.Clone(b.onLeave[group])
+	b.mu.Unlock()
+	for _, cb := range cbs {
+		cb(group, testItem(addr))
+	}
+}
+
+// testUpdateServer is an authoritative server accepting TSIG-signed
+// RFC 2136 updates.
+type testUpdateServer struct {
+	mu      sync.Mutex
+	records map[string]dns.RR
+}
+
+func (s *testUpdateServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	if r.Opcode != dns.OpcodeUpdate || r.IsTsig() == nil || w.TsigStatus() != nil {
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return
+	}
+	s.mu.Lock()
+	for _, rr := range r.Ns {
+		hdr := rr.Header()
+		switch hdr.Class {
+		case dns.ClassANY:
+			for key, existing := range s.records {
+				if existing.Header().Name == hdr.Name && existing.Header().Rrtype == hdr.Rrtype {
+					delete(s.records, key)
+				}
+			}
+		case dns.ClassNONE:
+			cp := dns.Copy(rr)
+			cp.Header().Class = dns.ClassINET
+			cp.Header().Ttl = 0
+			delete(s.records, cp.String())
+		default:
+			cp := dns.Copy(rr)
+			cp.Header().Ttl = 0
+			s.records[cp.String()] = rr
+		}
+	}
+	s.mu.Unlock()
+	m.SetReply(r)
+	m.SetTsig(r.IsTsig().Hdr.Name, r.IsTsig().Algorithm, 300, time.Now().Unix())
+	w.WriteMsg(m)
+}
+
+func (s *testUpdateServer) addresses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []string
+	for _, rr := range s.records {
+		switch rr := rr.(type) {
+		case *dns.A:
+			res = append(res, rr.Hdr.Name+" "+rr.A.String())
+		case *dns.AAAA:
+			res = append(res, rr.Hdr.Name+" "+rr.AAAA.String())
+		}
+	}
+	slices.Sort(res)
+	return res
+}
+
+// newTestUpdateServer starts testUpdateServer and returns it along with
+// its address.
+func newTestUpdateServer(t *testing.T) (*testUpdateServer, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &testUpdateServer{records: make(map[string]dns.RR)}
+	srv := &dns.Server{
+		Listener:   ln,
+		Handler:    state,
+		TsigSecret: map[string]string{"update-key.": testTSIGSecret},
+		// default function rejects UPDATE opcode
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	return state, ln.Addr().String()
+}
+
+// expect waits until server has exactly expected address records.
+func (s *testUpdateServer) expect(t *testing.T, step string, expected ...string) {
+	t.Helper()
+	var actual []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		actual = s.addresses()
+		if slices.Equal(actual, expected) {
+			return
+		}
+	}
+	t.Fatalf("%s: records %v, expected %v", step, actual, expected)
+}
+
+func testDNSUpdate(t *testing.T, bridge *testBridge, server, mappings string) {
+	t.Helper()
+	var cfg config.OutputConfig
+	if err := yaml.Unmarshal([]byte(`
+kind: dnsupdate
+spec:
+  server: `+server+`
+  zone: example.com
+  tsig:
+    name: update-key
+    secret: `+testTSIGSecret+`
+  interval: 1h
+  mappings:
+`+mappings), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	o, err := NewDNSUpdate(&cfg, bridge, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { o.Stop() })
+}
+
+func TestDNSUpdate(t *testing.T) {
+	state, server := newTestUpdateServer(t)
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1")}
+	testDNSUpdate(t, bridge, server, `
+    - group: 1000
+      hostname: worker.example.com
+      fallback_addresses:
+        - 192.0.2.1
+`)
+
+	state.expect(t, "initial reconciliation", "worker.example.com. 10.0.0.1")
+	bridge.join(1000, netip.MustParseAddr("10.0.0.2"))
+	bridge.join(1000, netip.MustParseAddr("2001:db8::1"))
+	state.expect(t, "join", "worker.example.com. 10.0.0.1", "worker.example.com. 10.0.0.2", "worker.example.com. 2001:db8::1")
+	bridge.leave(1000, netip.MustParseAddr("10.0.0.1"))
+	state.expect(t, "leave", "worker.example.com. 10.0.0.2", "worker.example.com. 2001:db8::1")
+	bridge.leave(1000, netip.MustParseAddr("10.0.0.2"))
+	bridge.leave(1000, netip.MustParseAddr("2001:db8::1"))
+	state.expect(t, "fallback", "worker.example.com. 192.0.2.1")
+	bridge.join(1000, netip.MustParseAddr("10.0.0.3"))
+	state.expect(t, "fallback recovery", "worker.example.com. 10.0.0.3")
+}
+
+func TestDNSUpdateSharedHostname(t *testing.T) {
+	state, server := newTestUpdateServer(t)
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.3")}
+	bridge.members[1001] = []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.4")}
+	testDNSUpdate(t, bridge, server, `
+    - group: 1000
+      hostname: shared.example.com
+    - group: 1001
+      hostname: shared.example.com
+`)
+
+	state.expect(t, "initial reconciliation",
+		"shared.example.com. 10.0.0.1", "shared.example.com. 10.0.0.2", "shared.example.com. 10.0.0.3", "shared.example.com. 10.0.0.4")
+	// address is still published for other group
+	bridge.leave(1000, netip.MustParseAddr("10.0.0.1"))
+	bridge.leave(1000, netip.MustParseAddr("10.0.0.2"))
+	state.expect(t, "leave of one group",
+		"shared.example.com. 10.0.0.1", "shared.example.com. 10.0.0.3", "shared.example.com. 10.0.0.4")
+	bridge.leave(1001, netip.MustParseAddr("10.0.0.1"))
+	state.expect(t, "leave of both groups", "shared.example.com. 10.0.0.3", "shared.example.com. 10.0.0.4")
+}
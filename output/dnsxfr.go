@@ -0,0 +1,426 @@
+package output
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	defaultDNSJournalSize   = 100
+	dnsZoneRefreshInterval  = 5 * time.Second
+	dnsNotifyTimeout        = 5 * time.Second
+	dnsNotifyAttempts       = 3
+	dnsTransferEnvelopeSize = 200
+)
+
+// defaultDNSTransferAllow limits transfers to local clients when neither
+// allowed clients nor TSIG key are configured.
+var defaultDNSTransferAllow = []util.IPPrefix{
+	util.IPPrefix(netip.MustParsePrefix("127.0.0.0/8")),
+	util.IPPrefix(netip.MustParsePrefix("::1/128")),
+}
+
+type DNSTransferConfig struct {
+	Allow       []util.IPPrefix
+	TSIGKey     string `yaml:"tsig_key"`
+	Notify      []util.ExpandableString
+	JournalSize int `yaml:"journal_size"`
+}
+
+type dnsTransfer struct {
+	allow       []util.IPPrefix
+	key         *tsigKey
+	notify      []string
+	journalSize int
+}
+
+func newDNSTransfer(cfg *DNSTransferConfig, keys map[string]*tsigKey) (*dnsTransfer, error) {
+	t := &dnsTransfer{
+		allow:       cfg.Allow,
+		journalSize: cfg.JournalSize,
+	}
+	if t.journalSize <= 0 {
+		t.journalSize = defaultDNSJournalSize
+	}
+	if cfg.TSIGKey != "" {
+		key, ok := keys[dns.CanonicalName(cfg.TSIGKey)]
+		if !ok {
+			return nil, fmt.Errorf("unknown TSIG key %q", cfg.TSIGKey)
+		}
+		t.key = key
+	}
+	if len(t.allow) == 0 && t.key == nil {
+		t.allow = defaultDNSTransferAllow
+	}
+	for _, target := range util.PlainStrings(cfg.Notify) {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			target = net.JoinHostPort(target, "53")
+		}
+		t.notify = append(t.notify, target)
+	}
+	return t, nil
+}
+
+// allowed reports whether zone transfer request is permitted.
+func (t *dnsTransfer) allowed(w dns.ResponseWriter, r *dns.Msg) bool {
+	if len(t.allow) > 0 {
+		client := addrFromNetAddr(w.RemoteAddr())
+		if !slices.ContainsFunc(t.allow, func(p util.IPPrefix) bool {
+			return p.Prefix().Contains(client)
+		}) {
+			return false
+		}
+	}
+	return t.key == nil || t.key.verified(w, r)
+}
+
+// dnsJournalEntry is a difference between two consecutive versions of the
+// zone.
+type dnsJournalEntry struct {
+	from    *dns.SOA
+	to      *dns.SOA
+	deleted []dns.RR
+	added   []dns.RR
+}
+
+// update replaces zone content with records, bumping serial and recording
+// changes into journal if content was changed. It reports if serial was
+// changed.
+func (z *dnsZone) update(records []dns.RR) bool {
+	slices.SortFunc(records, func(a, b dns.RR) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	records = slices.CompactFunc(records, func(a, b dns.RR) bool {
+		return a.String() == b.String()
+	})
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if !z.loaded {
+		z.loaded = true
+		z.records = records
+		return false
+	}
+
+	deleted, added := diffRecords(z.records, records)
+	if len(deleted) == 0 && len(added) == 0 {
+		return false
+	}
+	from := z.soa()
+	z.serial++
+	z.records = records
+	if z.transfer != nil {
+		z.journal = append(z.journal, dnsJournalEntry{
+			from:    from,
+			to:      z.soa(),
+			deleted: deleted,
+			added:   added,
+		})
+		if extra := len(z.journal) - z.transfer.journalSize; extra > 0 {
+			z.journal = slices.Delete(z.journal, 0, extra)
+		}
+	}
+	return true
+}
+
+// diffRecords finds difference between two sorted record sets.
+func diffRecords(old, cur []dns.RR) (deleted, added []dns.RR) {
+	i, j := 0, 0
+	for i < len(old) || j < len(cur) {
+		var c int
+		switch {
+		case i == len(old):
+			c = 1
+		case j == len(cur):
+			c = -1
+		default:
+			c = strings.Compare(old[i].String(), cur[j].String())
+		}
+		switch {
+		case c < 0:
+			deleted = append(deleted, old[i])
+			i++
+		case c > 0:
+			added = append(added, cur[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return deleted, added
+}
+
+// snapshot returns current SOA and zone content.
+func (z *dnsZone) snapshot() (*dns.SOA, []dns.RR, bool) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.soa(), z.records, z.loaded
+}
+
+// changesSince returns journal entries leading from serial to current
+// version of the zone.
+func (z *dnsZone) changesSince(serial uint32) ([]dnsJournalEntry, bool) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	idx := slices.IndexFunc(z.journal, func(e dnsJournalEntry) bool {
+		return e.from.Serial == serial
+	})
+	if idx < 0 {
+		return nil, false
+	}
+	return slices.Clone(z.journal[idx:]), true
+}
+
+// zoneOwns reports whether name belongs to zone rather than to some other
+// more specific zone.
+func (o *DNSServer) zoneOwns(zone *dnsZone, name string) bool {
+	return o.findZone(name) == zone
+}
+
+// zoneRecords builds full content of zone, except SOA and NS records at
+// the apex. Ordering, limits and topology preferences of mappings don't
+// apply here. TXT records are omitted as member metadata changes with
+// every announcement.
+func (o *DNSServer) zoneRecords(zone *dnsZone) ([]dns.RR, error) {
+	var records []dns.RR
+	addMapping := func(name string, target dnsTarget, perMember bool) error {
+		members, err := o.members(target)
+		if err != nil {
+			return fmt.Errorf("mapping %q: %w", name, err)
+		}
+		dom := dns.Fqdn(name)
+		for _, member := range members {
+			member.ttl = zone.recordTTL
+			records = append(records, addressRR(dom, addressType(member.addr), member.addr, member.ttl))
+			if perMember {
+				memberDom := memberName(member.addr, dom)
+				records = append(records, addressRR(memberDom, addressType(member.addr), member.addr, member.ttl))
+			}
+		}
+		return nil
+	}
+
+	for name, mapping := range o.mappings {
+		if !o.zoneOwns(zone, name) {
+			continue
+		}
+		if err := addMapping(name, dnsTarget{mapping, mapping.Group}, true); err != nil {
+			return nil, err
+		}
+	}
+	for parent, mapping := range o.wildcards {
+		name := "*." + parent
+		if !o.zoneOwns(zone, name) {
+			continue
+		}
+		if err := addMapping(name, dnsTarget{mapping, mapping.Group}, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range o.templates {
+		for _, group := range o.bridge.Groups() {
+			name := t.prefix + fmt.Sprint(group) + t.suffix + "." + t.parent
+			if !o.zoneOwns(zone, name) {
+				continue
+			}
+			if err := addMapping(name, dnsTarget{t.mapping, group}, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for name, svc := range o.services {
+		if !o.zoneOwns(zone, name) {
+			continue
+		}
+		mapping := o.mappings[svc.mapping]
+		members, err := o.members(dnsTarget{mapping, mapping.Group})
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", name, err)
+		}
+		for _, member := range members {
+			member.ttl = zone.recordTTL
+			records = append(records, member.SRV(dns.Fqdn(name), dns.Fqdn(svc.mapping), svc.DNSServiceConfig))
+		}
+	}
+	for i, rm := range o.reverse {
+		members, err := o.members(rm.target)
+		if err != nil {
+			// addresses of unavailable group are unknown, so they may
+			// belong to any reverse zone
+			if isReverseName(zone.origin()) {
+				return nil, fmt.Errorf("reverse mapping #%d: %w", i, err)
+			}
+			continue
+		}
+		for _, member := range members {
+			revName, _ := dns.ReverseAddr(member.addr.String())
+			if !o.zoneOwns(zone, canonicalDNSName(revName)) {
+				continue
+			}
+			records = append(records, &dns.PTR{
+				Hdr: dns.RR_Header{Name: revName, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: zone.recordTTL},
+				Ptr: formatReverseHostname(rm.Hostname, rm.Group, member.addr),
+			})
+		}
+	}
+	return records, nil
+}
+
+// refreshZone rebuilds zone content and notifies secondaries if it has
+// changed. Content is left intact if some of groups are not available at
+// the moment.
+func (o *DNSServer) refreshZone(zone *dnsZone) {
+	o.refreshMu.Lock()
+	defer o.refreshMu.Unlock()
+	records, err := o.zoneRecords(zone)
+	if err != nil {
+		o.logger.Debug("zone refresh postponed", "zone", zone.origin(), "err", err)
+		return
+	}
+	if !zone.update(records) {
+		return
+	}
+	o.logger.Info("zone updated", "zone", zone.origin(), "serial", zone.SOA().Serial)
+	if len(zone.transfer.notify) > 0 {
+		o.busy.Add(1)
+		go func() {
+			defer o.busy.Done()
+			o.notify(zone)
+		}()
+	}
+}
+
+func (o *DNSServer) serveTransfer(w dns.ResponseWriter, r *dns.Msg, q *dnsQuery) {
+	zone := o.findZone(q.name)
+	if zone == nil || zone.name != q.name {
+		o.replyRcode(w, r, dns.RcodeNotAuth)
+		return
+	}
+	if zone.transfer == nil || !zone.transfer.allowed(w, r) {
+		o.logger.Warn("zone transfer refused", "zone", zone.origin(), "client", w.RemoteAddr().String())
+		o.replyRcode(w, r, dns.RcodeRefused)
+		return
+	}
+	// content is kept up to date by sync loop
+	soa, records, loaded := zone.snapshot()
+	if !loaded {
+		o.replyRcode(w, r, dns.RcodeServerFailure)
+		return
+	}
+	_, isUDP := w.RemoteAddr().(*net.UDPAddr)
+
+	var rrs []dns.RR
+	if q.qtype == dns.TypeIXFR {
+		var clientSOA *dns.SOA
+		if len(r.Ns) > 0 {
+			clientSOA, _ = r.Ns[0].(*dns.SOA)
+		}
+		switch {
+		case clientSOA == nil:
+			o.replyRcode(w, r, dns.RcodeFormatError)
+			return
+		case clientSOA.Serial == soa.Serial || isUDP:
+			// up to date or has to retry over TCP
+			rrs = []dns.RR{soa}
+		default:
+			if changes, ok := zone.changesSince(clientSOA.Serial); ok {
+				rrs = append(rrs, soa)
+				for _, change := range changes {
+					rrs = append(rrs, change.from)
+					rrs = append(rrs, change.deleted...)
+					rrs = append(rrs, change.to)
+					rrs = append(rrs, change.added...)
+				}
+				rrs = append(rrs, soa)
+			}
+		}
+	} else if isUDP {
+		o.replyRcode(w, r, dns.RcodeFormatError)
+		return
+	}
+	if rrs == nil {
+		// full zone transfer
+		rrs = append(rrs, soa)
+		rrs = append(rrs, zone.NS()...)
+		rrs = append(rrs, records...)
+		rrs = append(rrs, soa)
+	}
+
+	ch := make(chan *dns.Envelope, len(rrs)/dnsTransferEnvelopeSize+1)
+	for chunk := range slices.Chunk(rrs, dnsTransferEnvelopeSize) {
+		ch <- &dns.Envelope{RR: chunk}
+	}
+	close(ch)
+	o.logger.Info("zone transfer", "zone", zone.origin(), "type", dns.Type(q.qtype).String(), "serial", soa.Serial, "records", len(rrs), "client", w.RemoteAddr().String())
+	if err := new(dns.Transfer).Out(w, r, ch); err != nil {
+		o.logger.Error("zone transfer failed", "zone", zone.origin(), "err", err)
+	}
+}
+
+// notify sends DNS NOTIFY about zone change to configured secondaries.
+func (o *DNSServer) notify(zone *dnsZone) {
+	c := &dns.Client{
+		Timeout:    dnsNotifyTimeout,
+		TsigSecret: tsigSecrets(o.tsigKeys),
+	}
+	for _, target := range zone.transfer.notify {
+		var err error
+		for i := 0; i < dnsNotifyAttempts; i++ {
+			m := new(dns.Msg)
+			m.SetNotify(zone.origin())
+			m.Answer = []dns.RR{zone.SOA()}
+			if zone.transfer.key != nil {
+				zone.transfer.key.sign(m)
+			}
+			var resp *dns.Msg
+			resp, _, err = c.Exchange(m, target)
+			if err == nil && resp.Rcode != dns.RcodeSuccess {
+				err = fmt.Errorf("NOTIFY rejected: %s", dns.RcodeToString[resp.Rcode])
+			}
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			o.logger.Error("zone change notification failed", "zone", zone.origin(), "target", target, "err", err)
+			continue
+		}
+		o.logger.Debug("sent zone change notification", "zone", zone.origin(), "target", target)
+	}
+}
+
+func (o *DNSServer) syncZones() {
+	select {
+	case o.syncQueue <- struct{}{}:
+	default:
+	}
+}
+
+// syncLoop keeps content of transferable zones up to date and notifies
+// secondaries about changes.
+func (o *DNSServer) syncLoop() {
+	ticker := time.NewTicker(dnsZoneRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.shutdown:
+			return
+		case <-ticker.C:
+		case <-o.syncQueue:
+		}
+		for _, zone := range o.zones {
+			if zone.transfer != nil {
+				o.refreshZone(zone)
+			}
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package output
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/SenseUnit/rgap/util"
+)
+
+// testNotifySink collects NOTIFY messages.
+type testNotifySink chan *dns.Msg
+
+func (s testNotifySink) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	if r.IsTsig() == nil || w.TsigStatus() != nil {
+		m.Rcode = dns.RcodeRefused
+	} else {
+		m.SetTsig(r.IsTsig().Hdr.Name, r.IsTsig().Algorithm, 300, time.Now().Unix())
+		s <- r
+	}
+	w.WriteMsg(m)
+}
+
+func testTransfer(t *testing.T, addr string, qtype uint16, serial uint32, signed bool) ([]dns.RR, error) {
+	t.Helper()
+	r := new(dns.Msg)
+	if qtype == dns.TypeIXFR {
+		r.SetIxfr("example.com.", serial, "ns1.example.com.", "hostmaster.example.com.")
+	} else {
+		r.SetAxfr("example.com.")
+	}
+	tr := &dns.Transfer{TsigSecret: map[string]string{"xfr-key.": testTSIGSecret}}
+	if signed {
+		r.SetTsig("xfr-key.", dns.HmacSHA256, 300, time.Now().Unix())
+	}
+	ch, err := tr.In(r, addr)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []dns.RR
+	for env := range ch {
+		if env.Error != nil {
+			return nil, env.Error
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	return rrs, nil
+}
+
+func soaSerials(rrs []dns.RR) []uint32 {
+	var res []uint32
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			res = append(res, soa.Serial)
+		}
+	}
+	return res
+}
+
+func TestDNSZoneTransfer(t *testing.T) {
+	sink := make(testNotifySink, 16)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifyServer := &dns.Server{
+		PacketConn: pc,
+		Handler:    sink,
+		TsigSecret: map[string]string{"xfr-key.": testTSIGSecret},
+		// default function rejects NOTIFY opcode
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go notifyServer.ActivateAndServe()
+	defer notifyServer.Shutdown()
+
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1")}
+	o := testDNSServer(t, bridge, `
+  bind_address: 127.0.0.1:0
+  mappings:
+    worker.example.com:
+      group: 1000
+  tsig_keys:
+    xfr-key:
+      secret: `+testTSIGSecret+`
+  zones:
+    example.com:
+      ns: [ns1.example.com]
+      serial: 100
+      record_ttl: 15s
+      transfer:
+        allow: [127.0.0.0/8]
+        tsig_key: xfr-key
+        notify: [`+pc.LocalAddr().String()+`]
+`)
+	if err := o.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Stop()
+	addr := o.tcpServer.Listener.Addr().String()
+
+	if _, err := testTransfer(t, addr, dns.TypeAXFR, 0, false); err == nil {
+		t.Fatal("unsigned transfer allowed")
+	}
+	rrs, err := testTransfer(t, addr, dns.TypeAXFR, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"example.com. 0 IN NS ns1.example.com.",
+		"worker.example.com. 0 IN A 10.0.0.1",
+		"10-0-0-1.worker.example.com. 0 IN A 10.0.0.1",
+	}
+	if len(rrs) < 2 || !slices.Equal(rrStrings(rrs[1:len(rrs)-1]), rrStrings(testRRs(t, expected))) {
+		t.Fatalf("AXFR %v, expected %q between SOA records", rrs, expected)
+	}
+	if serials := soaSerials(rrs); !slices.Equal(serials, []uint32{100, 100}) {
+		t.Fatalf("AXFR SOA serials %v", serials)
+	}
+	if ttl := rrs[2].Header().Ttl; ttl != 15 {
+		t.Errorf("transferred record TTL %d, expected record_ttl", ttl)
+	}
+
+	// membership change bumps serial and notifies secondaries
+	bridge.join(1000, netip.MustParseAddr("10.0.0.2"))
+	select {
+	case m := <-sink:
+		if m.Opcode != dns.OpcodeNotify || len(m.Answer) != 1 || m.Answer[0].(*dns.SOA).Serial != 101 {
+			t.Errorf("unexpected NOTIFY %v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no NOTIFY received")
+	}
+	c := &dns.Client{Net: "tcp"}
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeSOA)
+	resp, _, err := c.Exchange(q, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serials := soaSerials(resp.Answer); !slices.Equal(serials, []uint32{101}) {
+		t.Fatalf("SOA serials %v after change, expected 101", serials)
+	}
+
+	rrs, err = testTransfer(t, addr, dns.TypeIXFR, 100, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serials := soaSerials(rrs); !slices.Equal(serials, []uint32{101, 100, 101, 101}) {
+		t.Fatalf("IXFR SOA serials %v", serials)
+	}
+	added := rrStrings(rrs[3 : len(rrs)-1])
+	if expected := rrStrings(testRRs(t, []string{
+		"worker.example.com. 0 IN A 10.0.0.2",
+		"10-0-0-2.worker.example.com. 0 IN A 10.0.0.2",
+	})); !slices.Equal(added, expected) {
+		t.Errorf("IXFR added %q, expected %q", added, expected)
+	}
+
+	rrs, err = testTransfer(t, addr, dns.TypeIXFR, 101, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serials := soaSerials(rrs); len(rrs) != 1 || !slices.Equal(serials, []uint32{101}) {
+		t.Errorf("IXFR of current serial %v, expected single SOA", rrs)
+	}
+
+	// unknown serial falls back to full transfer
+	rrs, err = testTransfer(t, addr, dns.TypeIXFR, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 7 || !slices.Equal(soaSerials(rrs), []uint32{101, 101}) {
+		t.Errorf("IXFR of unknown serial %v, expected full zone", rrs)
+	}
+}
+
+func TestDNSTransferAllow(t *testing.T) {
+	key, err := newTSIGKey("xfr-key", DNSTSIGKey{Secret: testTSIGSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]*tsigKey{key.name: key}
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}
+	signed := new(dns.Msg)
+	signed.SetAxfr("example.com.")
+	signed.SetTsig("xfr-key.", dns.HmacSHA256, 300, time.Now().Unix())
+	unsigned := new(dns.Msg)
+	unsigned.SetAxfr("example.com.")
+
+	for _, tc := range []struct {
+		name   string
+		cfg    DNSTransferConfig
+		remote net.Addr
+		r      *dns.Msg
+		allow  bool
+	}{
+		{"default allows loopback", DNSTransferConfig{}, local, unsigned, true},
+		{"default refuses others", DNSTransferConfig{}, testTCPClient, unsigned, false},
+		{"key without allow list", DNSTransferConfig{TSIGKey: "xfr-key"}, testTCPClient, signed, true},
+		{"key required", DNSTransferConfig{TSIGKey: "xfr-key"}, local, unsigned, false},
+		{"explicit allow list", DNSTransferConfig{Allow: []util.IPPrefix{util.IPPrefix(netip.MustParsePrefix("192.0.2.0/24"))}}, testTCPClient, unsigned, true},
+		{"explicit allow list excludes loopback", DNSTransferConfig{Allow: []util.IPPrefix{util.IPPrefix(netip.MustParsePrefix("192.0.2.0/24"))}}, local, unsigned, false},
+	} {
+		xfr, err := newDNSTransfer(&tc.cfg, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed := xfr.allowed(&testResponseWriter{remote: tc.remote}, tc.r); allowed != tc.allow {
+			t.Errorf("%s: allowed %v, expected %v", tc.name, allowed, tc.allow)
+		}
+	}
+}
+
+func TestDNSZoneSOASnapshot(t *testing.T) {
+	bridge := newTestBridge()
+	bridge.members[1000] = []netip.Addr{netip.MustParseAddr("10.0.0.1")}
+	o := testDNSServer(t, bridge, `
+  mappings:
+    worker.example.com:
+      group: 1000
+  zones:
+    example.com:
+      serial: 100
+      transfer: {}
+`)
+	serial := func() uint32 {
+		t.Helper()
+		return testQuery(t, o, "example.com", dns.TypeSOA).Answer[0].(*dns.SOA).Serial
+	}
+	o.refreshZone(o.zones[0])
+	bridge.members[1000] = append(bridge.members[1000], netip.MustParseAddr("10.0.0.2"))
+	// SOA queries don't rebuild zone
+	if s := serial(); s != 100 {
+		t.Fatalf("serial %d before refresh, expected 100", s)
+	}
+	o.refreshZone(o.zones[0])
+	if s := serial(); s != 101 {
+		t.Fatalf("serial %d after refresh, expected 101", s)
+	}
+	o.refreshZone(o.zones[0])
+	if s := serial(); s != 101 {
+		t.Fatalf("serial %d after refresh without changes, expected 101", s)
+	}
+}
+
+func testRRs(t *testing.T, records []string) []dns.RR {
+	t.Helper()
+	var res []dns.RR
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, rr)
+	}
+	return res
+}
@@ -0,0 +1,150 @@
+package output
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultDNSZoneTTL         = 1 * time.Hour
+	defaultDNSZoneNegativeTTL = 30 * time.Second
+	defaultDNSZoneRefresh     = 1 * time.Hour
+	defaultDNSZoneRetry       = 10 * time.Minute
+	defaultDNSZoneExpire      = 7 * 24 * time.Hour
+	defaultDNSZoneRecordTTL   = 30 * time.Second
+)
+
+type DNSZoneConfig struct {
+	NS          []string
+	Admin       string
+	Serial      uint32
+	Refresh     time.Duration
+	Retry       time.Duration
+	Expire      time.Duration
+	TTL         time.Duration
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+	RecordTTL   time.Duration `yaml:"record_ttl"`
+	Transfer    *DNSTransferConfig
+}
+
+type dnsZone struct {
+	name        string
+	ns          []string
+	admin       string
+	serial      uint32
+	refresh     uint32
+	retry       uint32
+	expire      uint32
+	ttl         uint32
+	negativeTTL uint32
+	recordTTL   uint32
+	transfer    *dnsTransfer
+
+	mu      sync.Mutex
+	loaded  bool
+	records []dns.RR
+	journal []dnsJournalEntry
+}
+
+func newDNSZone(name string, cfg DNSZoneConfig, keys map[string]*tsigKey) (*dnsZone, error) {
+	origin := dns.Fqdn(name)
+	if _, ok := dns.IsDomainName(origin); !ok {
+		return nil, fmt.Errorf("bad zone name %q", name)
+	}
+	z := &dnsZone{
+		name:        name,
+		serial:      cfg.Serial,
+		refresh:     durationSeconds(cfg.Refresh, defaultDNSZoneRefresh),
+		retry:       durationSeconds(cfg.Retry, defaultDNSZoneRetry),
+		expire:      durationSeconds(cfg.Expire, defaultDNSZoneExpire),
+		ttl:         durationSeconds(cfg.TTL, defaultDNSZoneTTL),
+		negativeTTL: durationSeconds(cfg.NegativeTTL, defaultDNSZoneNegativeTTL),
+		recordTTL:   durationSeconds(cfg.RecordTTL, defaultDNSZoneRecordTTL),
+	}
+	if z.serial == 0 {
+		z.serial = uint32(time.Now().Unix())
+	}
+	for _, ns := range cfg.NS {
+		ns = dns.Fqdn(ns)
+		if _, ok := dns.IsDomainName(ns); !ok {
+			return nil, fmt.Errorf("zone %q: bad NS name %q", name, ns)
+		}
+		z.ns = append(z.ns, ns)
+	}
+	z.admin = cfg.Admin
+	if z.admin == "" {
+		z.admin = "hostmaster." + origin
+	}
+	z.admin = dns.Fqdn(z.admin)
+	if _, ok := dns.IsDomainName(z.admin); !ok {
+		return nil, fmt.Errorf("zone %q: bad admin mailbox %q", name, cfg.Admin)
+	}
+	if cfg.Transfer != nil {
+		transfer, err := newDNSTransfer(cfg.Transfer, keys)
+		if err != nil {
+			return nil, fmt.Errorf("zone %q: %w", name, err)
+		}
+		z.transfer = transfer
+	}
+	return z, nil
+}
+
+func durationSeconds(d, def time.Duration) uint32 {
+	if d <= 0 {
+		d = def
+	}
+	return uint32(d / time.Second)
+}
+
+func (z *dnsZone) origin() string {
+	return dns.Fqdn(z.name)
+}
+
+func (z *dnsZone) contains(name string) bool {
+	return dns.IsSubDomain(z.origin(), dns.Fqdn(name))
+}
+
+func (z *dnsZone) SOA() *dns.SOA {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.soa()
+}
+
+func (z *dnsZone) soa() *dns.SOA {
+	mname := z.origin()
+	if len(z.ns) > 0 {
+		mname = z.ns[0]
+	}
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: z.origin(), Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: z.ttl},
+		Ns:      mname,
+		Mbox:    z.admin,
+		Serial:  z.serial,
+		Refresh: z.refresh,
+		Retry:   z.retry,
+		Expire:  z.expire,
+		Minttl:  z.negativeTTL,
+	}
+}
+
+// NegativeSOA returns SOA record for authority section of negative
+// responses. Its TTL is capped by SOA MINIMUM as described in RFC 2308.
+func (z *dnsZone) NegativeSOA() *dns.SOA {
+	soa := z.SOA()
+	soa.Hdr.Ttl = min(z.ttl, z.negativeTTL)
+	return soa
+}
+
+func (z *dnsZone) NS() []dns.RR {
+	res := make([]dns.RR, 0, len(z.ns))
+	for _, ns := range z.ns {
+		res = append(res, &dns.NS{
+			Hdr: dns.RR_Header{Name: z.origin(), Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: z.ttl},
+			Ns:  ns,
+		})
+	}
+	return res
+}
@@ -2,7 +2,7 @@ package output
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/SenseUnit/rgap/config"
 	"github.com/SenseUnit/rgap/iface"
@@ -17,16 +17,18 @@ type EventLog struct {
 	bridge   iface.GroupBridge
 	groups   []uint64
 	unsubFns []func()
+	logger   *slog.Logger
 }
 
-func NewEventLog(cfg *config.OutputConfig, bridge iface.GroupBridge) (*EventLog, error) {
+func NewEventLog(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (*EventLog, error) {
 	var lc EventLogConfig
 	if err := util.CheckedUnmarshal(&cfg.Spec, &lc); err != nil {
-		return nil, fmt.Errorf("cannot unmarshal log output config: %w", err)
+		return nil, fmt.Errorf("cannot unmarshal eventlog output config: %w", err)
 	}
 	return &EventLog{
 		bridge: bridge,
 		groups: lc.Groups,
+		logger: logger,
 	}, nil
 }
 
@@ -39,14 +41,14 @@ func (o *EventLog) Start() error {
 	for _, group := range groups {
 		o.unsubFns = append(o.unsubFns,
 			o.bridge.OnJoin(group, func(group uint64, item iface.GroupItem) {
-				log.Printf("host %s has joined group %d", item.Address().Unmap().String(), group)
+				o.logger.Info("host has joined group", "host", item.Address().Unmap().String(), "group", group, "flaps", item.Flaps())
 			}),
 			o.bridge.OnLeave(group, func(group uint64, item iface.GroupItem) {
-				log.Printf("host %s has left group %d", item.Address().Unmap().String(), group)
+				o.logger.Info("host has left group", "host", item.Address().Unmap().String(), "group", group)
 			}),
 		)
 	}
-	log.Println("started event log output plugin")
+	o.logger.Info("started event log output plugin")
 	return nil
 }
 
@@ -54,6 +56,6 @@ func (o *EventLog) Stop() error {
 	for _, unsub := range o.unsubFns {
 		unsub()
 	}
-	log.Println("stopped event log output plugin")
+	o.logger.Info("stopped event log output plugin")
 	return nil
 }
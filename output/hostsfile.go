@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -18,12 +18,13 @@ import (
 type GroupHostMapping struct {
 	Group             uint64
 	Hostname          string
-	FallbackAddresses []util.IPAddr `yaml:"fallback_addresses"`
+	FallbackAddresses []util.IPAddr  `yaml:"fallback_addresses"`
+	OnDegraded        DegradedPolicy `yaml:"on_degraded"`
 }
 
 type HostsFileConfig struct {
 	Interval     time.Duration
-	Filename     string
+	Filename     util.ExpandableString
 	Mappings     []GroupHostMapping
 	PrependLines []string `yaml:"prepend_lines"`
 	AppendLines  []string `yaml:"append_lines"`
@@ -39,12 +40,13 @@ type HostsFile struct {
 	ctx          context.Context
 	ctxCancel    func()
 	loopDone     chan struct{}
+	logger       *slog.Logger
 }
 
-func NewHostsFile(cfg *config.OutputConfig, bridge iface.GroupBridge) (*HostsFile, error) {
+func NewHostsFile(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (*HostsFile, error) {
 	var hc HostsFileConfig
 	if err := util.CheckedUnmarshal(&cfg.Spec, &hc); err != nil {
-		return nil, fmt.Errorf("cannot unmarshal log output config: %w", err)
+		return nil, fmt.Errorf("cannot unmarshal hostsfile output config: %w", err)
 	}
 	if hc.Interval <= 0 {
 		return nil, fmt.Errorf("incorrect hosts file update interval: %v", hc.Interval)
@@ -56,6 +58,9 @@ func NewHostsFile(cfg *config.OutputConfig, bridge iface.GroupBridge) (*HostsFil
 		if mapping.Hostname == "" {
 			return nil, fmt.Errorf("mapping with index %d has no hostname defined", i)
 		}
+		if mapping.OnDegraded == DegradedFallback && len(mapping.FallbackAddresses) == 0 {
+			return nil, fmt.Errorf("mapping with index %d: on_degraded is %s, but no fallback_addresses are specified", i, DegradedFallback)
+		}
 	}
 	prependLines := make([]string, 0, len(hc.PrependLines))
 	for _, line := range hc.PrependLines {
@@ -68,10 +73,11 @@ func NewHostsFile(cfg *config.OutputConfig, bridge iface.GroupBridge) (*HostsFil
 	return &HostsFile{
 		bridge:       bridge,
 		interval:     hc.Interval,
-		filename:     hc.Filename,
+		filename:     string(hc.Filename),
 		mappings:     hc.Mappings,
 		prependLines: prependLines,
 		appendLines:  appendLines,
+		logger:       logger.With("filename", string(hc.Filename)),
 	}, nil
 }
 
@@ -81,14 +87,14 @@ func (o *HostsFile) Start() error {
 	o.ctxCancel = cancel
 	o.loopDone = make(chan struct{})
 	go o.loop()
-	log.Printf("started hostsfile (%s) output plugin", o.filename)
+	o.logger.Info("started hostsfile output plugin")
 	return nil
 }
 
 func (o *HostsFile) Stop() error {
 	o.ctxCancel()
 	<-o.loopDone
-	log.Printf("stopped hostsfile (%s) output plugin", o.filename)
+	o.logger.Info("stopped hostsfile output plugin")
 	return nil
 }
 
@@ -107,14 +113,21 @@ func (o *HostsFile) loop() {
 }
 
 func (o *HostsFile) dump() {
-	var notReadyGroups []uint64
+	var notReadyGroups, degradedGroups []uint64
 	for _, mapping := range o.mappings {
 		if !o.bridge.GroupReady(mapping.Group) {
 			notReadyGroups = append(notReadyGroups, mapping.Group)
 		}
+		if mapping.OnDegraded == DegradedRefuse && o.bridge.GroupDegraded(mapping.Group) {
+			degradedGroups = append(degradedGroups, mapping.Group)
+		}
 	}
 	if len(notReadyGroups) > 0 {
-		log.Printf("hostsfile: skipping update because following groups are not ready yet: %v", notReadyGroups)
+		o.logger.Info("skipping update because some groups are not ready yet", "groups", notReadyGroups)
+		return
+	}
+	if len(degradedGroups) > 0 {
+		o.logger.Warn("skipping update because some groups are degraded", "groups", degradedGroups)
 		return
 	}
 
@@ -124,7 +137,7 @@ func (o *HostsFile) dump() {
 	}
 	for _, mapping := range o.mappings {
 		items := o.bridge.ListGroup(mapping.Group)
-		if len(items) == 0 {
+		if len(items) == 0 || (mapping.OnDegraded == DegradedFallback && o.bridge.GroupDegraded(mapping.Group)) {
 			for _, addr := range mapping.FallbackAddresses {
 				fmt.Fprintf(&buf, "%s %s # fallback address used!\n", addr.String(), mapping.Hostname)
 			}
@@ -138,6 +151,6 @@ func (o *HostsFile) dump() {
 		fmt.Fprintln(&buf, line)
 	}
 	if err := atomicfile.WriteFile(o.filename, &buf); err != nil {
-		log.Printf("unable to update destination file: %v", err)
+		o.logger.Error("unable to update destination file", "err", err)
 	}
 }
@@ -0,0 +1,136 @@
+package output
+
+import (
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/SenseUnit/rgap/config"
+)
+
+func testOutputConfig(t *testing.T, doc string) *config.OutputConfig {
+	t.Helper()
+	var cfg config.OutputConfig
+	if err := yaml.Unmarshal([]byte(doc), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return &cfg
+}
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestHostsFileDegradedPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy   string
+		members  []string
+		degraded bool
+		expected string
+	}{
+		{"publish", []string{"10.0.0.1"}, false, "10.0.0.1 worker.example.com\n"},
+		{"publish", []string{"10.0.0.1"}, true, "10.0.0.1 worker.example.com\n"},
+		{"publish", nil, false, "192.0.2.1 worker.example.com # fallback address used!\n"},
+		{"fallback", []string{"10.0.0.1"}, false, "10.0.0.1 worker.example.com\n"},
+		{"fallback", []string{"10.0.0.1"}, true, "192.0.2.1 worker.example.com # fallback address used!\n"},
+		{"refuse", []string{"10.0.0.1"}, false, "10.0.0.1 worker.example.com\n"},
+		{"refuse", []string{"10.0.0.1"}, true, "previous content\n"},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "hosts")
+			if err := os.WriteFile(filename, []byte("previous content\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			bridge := newTestBridge()
+			for _, member := range tc.members {
+				bridge.members[1000] = append(bridge.members[1000], netip.MustParseAddr(member))
+			}
+			bridge.degraded[1000] = tc.degraded
+			o, err := NewHostsFile(testOutputConfig(t, `
+kind: hostsfile
+spec:
+  interval: 1m
+  filename: `+filename+`
+  mappings:
+    - group: 1000
+      hostname: worker.example.com
+      fallback_addresses: [192.0.2.1]
+      on_degraded: `+tc.policy+`
+`), bridge, testLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.dump()
+			content, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tc.expected {
+				t.Errorf("members=%v degraded=%v: hosts file %q, expected %q", tc.members, tc.degraded, content, tc.expected)
+			}
+		})
+	}
+}
+
+func TestDegradedPolicyYAML(t *testing.T) {
+	for _, policy := range []DegradedPolicy{DegradedPublish, DegradedFallback, DegradedRefuse} {
+		doc, err := yaml.Marshal(policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded DegradedPolicy
+		if err := yaml.Unmarshal(doc, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded != policy {
+			t.Errorf("policy %v decoded as %v", policy, decoded)
+		}
+	}
+	var p DegradedPolicy
+	if err := yaml.Unmarshal([]byte("ignore"), &p); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
+
+func TestDegradedFallbackRequiresAddresses(t *testing.T) {
+	bridge := newTestBridge()
+	if _, err := NewHostsFile(testOutputConfig(t, `
+kind: hostsfile
+spec:
+  interval: 1m
+  filename: /tmp/hosts
+  mappings:
+    - group: 1000
+      hostname: worker.example.com
+      on_degraded: fallback
+`), bridge, testLogger); err == nil {
+		t.Error("hostsfile: fallback policy without fallback addresses accepted")
+	}
+	if _, err := NewDNSUpdate(testOutputConfig(t, `
+kind: dnsupdate
+spec:
+  server: 127.0.0.1:53
+  zone: example.com
+  interval: 1h
+  mappings:
+    - group: 1000
+      hostname: worker.example.com
+      on_degraded: fallback
+`), bridge, testLogger); err == nil {
+		t.Error("dnsupdate: fallback policy without fallback addresses accepted")
+	}
+	if _, err := NewDNSServer(testOutputConfig(t, `
+kind: dns
+spec:
+  bind_address: 127.0.0.1:0
+  mappings:
+    worker.example.com:
+      group: 1000
+      on_degraded: fallback
+`), bridge, testLogger); err == nil {
+		t.Error("dns: fallback policy without fallback addresses accepted")
+	}
+}
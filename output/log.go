@@ -3,8 +3,7 @@ package output
 import (
 	"context"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
 	"time"
 
 	"github.com/SenseUnit/rgap/config"
@@ -22,9 +21,10 @@ type Log struct {
 	ctx       context.Context
 	ctxCancel func()
 	loopDone  chan struct{}
+	logger    *slog.Logger
 }
 
-func NewLog(cfg *config.OutputConfig, bridge iface.GroupBridge) (*Log, error) {
+func NewLog(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (*Log, error) {
 	var lc LogConfig
 	if err := util.CheckedUnmarshal(&cfg.Spec, &lc); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal log output config: %w", err)
@@ -35,6 +35,7 @@ func NewLog(cfg *config.OutputConfig, bridge iface.GroupBridge) (*Log, error) {
 	return &Log{
 		interval: lc.Interval,
 		bridge:   bridge,
+		logger:   logger,
 	}, nil
 }
 
@@ -44,14 +45,14 @@ func (o *Log) Start() error {
 	o.ctxCancel = cancel
 	o.loopDone = make(chan struct{})
 	go o.loop()
-	log.Println("started log output plugin")
+	o.logger.Info("started log output plugin")
 	return nil
 }
 
 func (o *Log) Stop() error {
 	o.ctxCancel()
 	<-o.loopDone
-	log.Println("stopped log output plugin")
+	o.logger.Info("stopped log output plugin")
 	return nil
 }
 
@@ -69,20 +70,29 @@ func (o *Log) loop() {
 	}
 }
 
-var readinessLabels = map[bool]string{
-	true:  "READY",
-	false: "NOT READY",
+type logMember struct {
+	Address   string    `json:"address"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Flaps     uint64    `json:"flaps,omitempty"`
 }
 
 func (o *Log) dump() {
-	var report strings.Builder
-	fmt.Fprintln(&report, "Groups snapshot:")
 	for _, gid := range o.bridge.Groups() {
 		grpItems := o.bridge.ListGroup(gid)
-		fmt.Fprintf(&report, "  - Group %d (%s, %d entries):\n", gid, readinessLabels[o.bridge.GroupReady(gid)], len(grpItems))
+		members := make([]logMember, 0, len(grpItems))
 		for _, item := range grpItems {
-			fmt.Fprintf(&report, "    - %s (till %v)\n", item.Address().Unmap().String(), item.ExpiresAt())
+			members = append(members, logMember{
+				Address:   item.Address().Unmap().String(),
+				ExpiresAt: item.ExpiresAt(),
+				Flaps:     item.Flaps(),
+			})
 		}
+		o.logger.Info("group snapshot",
+			"group", gid,
+			"ready", o.bridge.GroupReady(gid),
+			"degraded", o.bridge.GroupDegraded(gid),
+			"entries", len(grpItems),
+			"members", members,
+		)
 	}
-	log.Println(report.String())
 }
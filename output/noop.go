@@ -1,19 +1,23 @@
 package output
 
-import "log"
+import "log/slog"
 
-type NoOp struct{}
+type NoOp struct {
+	logger *slog.Logger
+}
 
-func NewNoOp() NoOp {
-	return NoOp{}
+func NewNoOp(logger *slog.Logger) NoOp {
+	return NoOp{
+		logger: logger,
+	}
 }
 
-func (_ NoOp) Start() error {
-	log.Println("new NoOp output started.")
+func (o NoOp) Start() error {
+	o.logger.Info("new NoOp output started")
 	return nil
 }
 
-func (_ NoOp) Stop() error {
-	log.Println("NoOp output stopped.")
+func (o NoOp) Stop() error {
+	o.logger.Info("NoOp output stopped")
 	return nil
 }
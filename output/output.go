@@ -2,38 +2,84 @@ package output
 
 import (
 	"errors"
+	"log/slog"
 
 	"github.com/SenseUnit/rgap/config"
 	"github.com/SenseUnit/rgap/iface"
 )
 
-type OutputCtor func(*config.OutputConfig, iface.GroupBridge) (iface.StartStopper, error)
+type OutputCtor func(*config.OutputConfig, iface.GroupBridge, *slog.Logger) (iface.StartStopper, error)
 
-var outputVCMap = map[string]OutputCtor{
-	"noop": func(_ *config.OutputConfig, _ iface.GroupBridge) (iface.StartStopper, error) {
-		return NewNoOp(), nil
+type outputKind struct {
+	ctor OutputCtor
+	// zero value of spec type, used for schema generation.
+	// nil if output doesn't accept spec.
+	spec interface{}
+}
+
+var outputVCMap = map[string]outputKind{
+	"noop": {
+		ctor: func(_ *config.OutputConfig, _ iface.GroupBridge, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewNoOp(logger), nil
+		},
+	},
+	"log": {
+		ctor: func(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewLog(cfg, bridge, logger)
+		},
+		spec: LogConfig{},
+	},
+	"hostsfile": {
+		ctor: func(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewHostsFile(cfg, bridge, logger)
+		},
+		spec: HostsFileConfig{},
 	},
-	"log": func(cfg *config.OutputConfig, bridge iface.GroupBridge) (iface.StartStopper, error) {
-		return NewLog(cfg, bridge)
+	"dns": {
+		ctor: func(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewDNSServer(cfg, bridge, logger)
+		},
+		spec: DNSServerConfig{},
 	},
-	"hostsfile": func(cfg *config.OutputConfig, bridge iface.GroupBridge) (iface.StartStopper, error) {
-		return NewHostsFile(cfg, bridge)
+	"dnsupdate": {
+		ctor: func(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewDNSUpdate(cfg, bridge, logger)
+		},
+		spec: DNSUpdateConfig{},
 	},
-	"dns": func(cfg *config.OutputConfig, bridge iface.GroupBridge) (iface.StartStopper, error) {
-		return NewDNSServer(cfg, bridge)
+	"eventlog": {
+		ctor: func(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewEventLog(cfg, bridge, logger)
+		},
+		spec: EventLogConfig{},
 	},
-	"eventlog": func(cfg *config.OutputConfig, bridge iface.GroupBridge) (iface.StartStopper, error) {
-		return NewEventLog(cfg, bridge)
+	"command": {
+		ctor: func(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewCommand(cfg, bridge, logger)
+		},
+		spec: CommandConfig{},
 	},
-	"command": func(cfg *config.OutputConfig, bridge iface.GroupBridge) (iface.StartStopper, error) {
-		return NewCommand(cfg, bridge)
+	"rejectlog": {
+		ctor: func(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (iface.StartStopper, error) {
+			return NewRejectLog(cfg, bridge, logger)
+		},
+		spec: RejectLogConfig{},
 	},
 }
 
-func OutputFromConfig(cfg *config.OutputConfig, bridge iface.GroupBridge) (iface.StartStopper, error) {
-	ctor, ok := outputVCMap[cfg.Kind]
+func OutputFromConfig(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (iface.StartStopper, error) {
+	kind, ok := outputVCMap[cfg.Kind]
 	if !ok {
 		return nil, errors.New("unknown kind of output")
 	}
-	return ctor(cfg, bridge)
+	return kind.ctor(cfg, bridge, logger.With("output", cfg.Kind))
+}
+
+// OutputSpecs returns zero values of spec types of all known output kinds.
+func OutputSpecs() map[string]interface{} {
+	res := make(map[string]interface{}, len(outputVCMap))
+	for name, kind := range outputVCMap {
+		res[name] = kind.spec
+	}
+	return res
 }
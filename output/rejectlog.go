@@ -0,0 +1,126 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/iface"
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	defaultRejectLogInterval = 1 * time.Minute
+)
+
+type RejectLogConfig struct {
+	Interval time.Duration
+	Groups   []uint64 `yaml:"only_groups"`
+}
+
+type rejectKey struct {
+	sender string
+	group  uint64
+	reason string
+}
+
+type RejectLog struct {
+	bridge     iface.GroupBridge
+	interval   time.Duration
+	groups     map[uint64]struct{}
+	suppressed *ttlcache.Cache[rejectKey, *atomic.Uint64]
+	unsubFns   []func()
+	logger     *slog.Logger
+}
+
+func NewRejectLog(cfg *config.OutputConfig, bridge iface.GroupBridge, logger *slog.Logger) (*RejectLog, error) {
+	var rc RejectLogConfig
+	if err := util.CheckedUnmarshal(&cfg.Spec, &rc); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal rejectlog output config: %w", err)
+	}
+	if rc.Interval < 0 {
+		return nil, fmt.Errorf("incorrect rejectlog interval: %v", rc.Interval)
+	}
+	if rc.Interval == 0 {
+		rc.Interval = defaultRejectLogInterval
+	}
+	o := &RejectLog{
+		bridge:   bridge,
+		interval: rc.Interval,
+		logger:   logger,
+	}
+	if rc.Groups != nil {
+		o.groups = make(map[uint64]struct{})
+		for _, gid := range rc.Groups {
+			o.groups[gid] = struct{}{}
+		}
+	}
+	return o, nil
+}
+
+func (o *RejectLog) Start() error {
+	o.suppressed = ttlcache.New[rejectKey, *atomic.Uint64](
+		ttlcache.WithTTL[rejectKey, *atomic.Uint64](o.interval),
+		ttlcache.WithDisableTouchOnHit[rejectKey, *atomic.Uint64](),
+	)
+	o.unsubFns = append(o.unsubFns,
+		o.suppressed.OnEviction(func(_ context.Context, _ ttlcache.EvictionReason, item *ttlcache.Item[rejectKey, *atomic.Uint64]) {
+			if n := item.Value().Load(); n > 0 {
+				key := item.Key()
+				o.logger.Warn("more announcements were rejected",
+					"count", n, "sender", key.sender, "group", key.group, "reason", key.reason, "interval", o.interval)
+			}
+		}),
+		o.bridge.OnReject(o.handleRejection),
+	)
+	go o.suppressed.Start()
+	o.logger.Info("started rejectlog output plugin")
+	return nil
+}
+
+func (o *RejectLog) Stop() error {
+	for _, unsub := range o.unsubFns {
+		unsub()
+	}
+	o.suppressed.Stop()
+	o.logger.Info("stopped rejectlog output plugin")
+	return nil
+}
+
+func (o *RejectLog) handleRejection(r iface.Rejection) {
+	if o.groups != nil {
+		if _, ok := o.groups[r.Group()]; !ok {
+			return
+		}
+	}
+	// ephemeral source ports change with every announcement,
+	// so only sender host is considered for rate limiting
+	sender := r.Sender()
+	if host, _, err := net.SplitHostPort(sender); err == nil {
+		sender = host
+	}
+	key := rejectKey{
+		sender: sender,
+		group:  r.Group(),
+		reason: r.Reason(),
+	}
+	counter, found := o.suppressed.GetOrSet(key, new(atomic.Uint64))
+	if found {
+		counter.Value().Add(1)
+		return
+	}
+	o.logger.Warn("announcement rejected",
+		"reason", r.Reason(),
+		"sender", r.Sender(),
+		"source", r.Source(),
+		"group", r.Group(),
+		"address", r.Address().String(),
+		"drift", r.Drift(),
+	)
+}
@@ -0,0 +1,115 @@
+package output
+
+import (
+	"bytes"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SenseUnit/rgap/iface"
+)
+
+type testRejection struct {
+	sender string
+	group  uint64
+	reason string
+}
+
+func (r *testRejection) Time() time.Time      { return time.Now() }
+func (r *testRejection) Source() string       { return "udp" }
+func (r *testRejection) Sender() string       { return r.sender }
+func (r *testRejection) Group() uint64        { return r.group }
+func (r *testRejection) Address() netip.Addr  { return netip.MustParseAddr("10.0.0.1") }
+func (r *testRejection) Reason() string       { return r.reason }
+func (r *testRejection) Drift() time.Duration { return time.Second }
+
+// syncBuffer collects log output written from multiple goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *syncBuffer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *syncBuffer) lines(substr string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var res []string
+	for _, line := range strings.Split(w.buf.String(), "\n") {
+		if strings.Contains(line, substr) {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+func TestRejectLog(t *testing.T) {
+	var logs syncBuffer
+	o, err := NewRejectLog(testOutputConfig(t, `
+kind: rejectlog
+spec:
+  interval: 200ms
+  only_groups: [1000]
+`), newTestBridge(), slog.New(slog.NewTextHandler(&logs, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Stop()
+
+	// repeats from other source ports of the same host are suppressed
+	for _, sender := range []string{"192.0.2.1:1000", "192.0.2.1:1001", "192.0.2.1:1002"} {
+		o.handleRejection(&testRejection{sender: sender, group: 1000, reason: iface.RejectBadSignature})
+	}
+	o.handleRejection(&testRejection{sender: "192.0.2.1:1003", group: 1000, reason: iface.RejectClockSkew})
+	o.handleRejection(&testRejection{sender: "192.0.2.2:1000", group: 1000, reason: iface.RejectBadSignature})
+	// groups not listed in only_groups are ignored
+	o.handleRejection(&testRejection{sender: "192.0.2.1:1000", group: 2000, reason: iface.RejectBadSignature})
+
+	first := logs.lines("msg=\"announcement rejected\"")
+	if len(first) != 3 {
+		t.Fatalf("expected 3 logged rejections, got:\n%s", strings.Join(first, "\n"))
+	}
+	if !strings.Contains(first[0], `reason="bad signature"`) || !strings.Contains(first[0], "sender=192.0.2.1:1000") {
+		t.Errorf("unexpected first rejection: %s", first[0])
+	}
+
+	var summary []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if summary = logs.lines("more announcements were rejected"); len(summary) > 0 {
+			break
+		}
+	}
+	// give other entries a chance to expire too
+	time.Sleep(300 * time.Millisecond)
+	summary = logs.lines("more announcements were rejected")
+	if len(summary) != 1 {
+		t.Fatalf("expected single summary of repeated rejections, got:\n%s", strings.Join(summary, "\n"))
+	}
+	for _, attr := range []string{"count=2", "sender=192.0.2.1 ", `reason="bad signature"`, "group=1000"} {
+		if !strings.Contains(summary[0], attr) {
+			t.Errorf("summary %q doesn't contain %q", summary[0], attr)
+		}
+	}
+
+	// suppression window is over, so next rejection is logged again
+	o.handleRejection(&testRejection{sender: "192.0.2.1:1004", group: 1000, reason: iface.RejectBadSignature})
+	if n := len(logs.lines("msg=\"announcement rejected\"")); n != 4 {
+		t.Errorf("rejection after suppression window is not logged, %d logged in total", n)
+	}
+}
+
+func TestRejectLogConfig(t *testing.T) {
+	if _, err := NewRejectLog(testOutputConfig(t, "kind: rejectlog\nspec:\n  interval: -1s\n"), newTestBridge(), testLogger); err == nil {
+		t.Error("negative interval accepted")
+	}
+}
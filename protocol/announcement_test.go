@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -53,3 +54,30 @@ func TestMarshalUnmarshal(t *testing.T) {
 		t.Error("message is not equal to original after serialization/deserialization round trip")
 	}
 }
+
+func TestJSONRoundTrip(t *testing.T) {
+	key := util.Must(psk.GeneratePSK())
+
+	msg := Announcement{
+		Data: AnnouncementData{
+			Version:          V1,
+			RedundancyID:     1000,
+			Timestamp:        time.Now().UnixMicro(),
+			AnnouncedAddress: [16]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 127, 0, 0, 1},
+		},
+	}
+	msg.Signature = util.Must(msg.Data.CalculateSignature(key))
+
+	doc := util.Must(json.Marshal(&msg))
+	t.Logf("%s", doc)
+
+	msg1 := Announcement{}
+	noError(json.Unmarshal(doc, &msg1))
+	if res := util.Must(msg1.CheckSignature(key)); !res {
+		t.Error("signature verification failed!")
+		return
+	}
+	if msg1 != msg {
+		t.Error("message is not equal to original after JSON round trip")
+	}
+}
@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+)
+
+type announcementJSON struct {
+	Version   uint16     `json:"version"`
+	Group     uint64     `json:"group"`
+	Timestamp int64      `json:"timestamp"`
+	Address   netip.Addr `json:"address"`
+	Signature string     `json:"signature"`
+}
+
+func (a *Announcement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(announcementJSON{
+		Version:   a.Data.Version,
+		Group:     a.Data.RedundancyID,
+		Timestamp: a.Data.Timestamp,
+		Address:   netip.AddrFrom16(a.Data.AnnouncedAddress).Unmap(),
+		Signature: hex.EncodeToString(a.Signature[:]),
+	})
+}
+
+func (a *Announcement) UnmarshalJSON(data []byte) error {
+	var aj announcementJSON
+	if err := json.Unmarshal(data, &aj); err != nil {
+		return fmt.Errorf("JSON unmarshaling of announcement failed: %w", err)
+	}
+	if !aj.Address.IsValid() {
+		return fmt.Errorf("announcement has no valid address")
+	}
+	sig, err := hex.DecodeString(aj.Signature)
+	if err != nil {
+		return fmt.Errorf("announcement signature hex decoding failed: %w", err)
+	}
+	if len(sig) != SignatureSize {
+		return fmt.Errorf("incorrect signature length. Expected %d, got %d", SignatureSize, len(sig))
+	}
+	a.Data = AnnouncementData{
+		Version:          aj.Version,
+		RedundancyID:     aj.Group,
+		Timestamp:        aj.Timestamp,
+		AnnouncedAddress: aj.Address.As16(),
+	}
+	copy(a.Signature[:], sig)
+	return nil
+}
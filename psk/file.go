@@ -0,0 +1,40 @@
+package psk
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadFile reads hex-encoded PSK from file.
+func LoadFile(filename string) (PSK, error) {
+	var psk PSK
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return psk, fmt.Errorf("unable to read PSK file: %w", err)
+	}
+	if err := psk.FromHexString(strings.TrimSpace(string(content))); err != nil {
+		return psk, fmt.Errorf("bad PSK file %s: %w", filename, err)
+	}
+	return psk, nil
+}
+
+// WriteFile writes hex-encoded PSK into file accessible only by its owner.
+// Permissions of existing file are reset as well.
+func WriteFile(filename string, psk PSK) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open PSK file: %w", err)
+	}
+	defer f.Close()
+	if err := f.Chmod(0600); err != nil {
+		return fmt.Errorf("unable to set PSK file permissions: %w", err)
+	}
+	if _, err := fmt.Fprintln(f, psk.AsHexString()); err != nil {
+		return fmt.Errorf("unable to write PSK file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write PSK file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package psk
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+)
+
+// KDF parameters are fixed, so the same passphrase and salt always
+// produce the same key. Changing them breaks key recovery.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+)
+
+// DerivePSK deterministically derives PSK from passphrase and salt using
+// specified key derivation function.
+func DerivePSK(kdf string, passphrase, salt []byte) (PSK, error) {
+	var psk PSK
+	if len(passphrase) == 0 {
+		return psk, errors.New("empty passphrase")
+	}
+	if len(salt) == 0 {
+		return psk, errors.New("empty salt")
+	}
+	switch kdf {
+	case KDFScrypt:
+		key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, PSKSize)
+		if err != nil {
+			return psk, fmt.Errorf("scrypt key derivation failed: %w", err)
+		}
+		copy(psk.AsSlice(), key)
+	case KDFArgon2id:
+		copy(psk.AsSlice(), argon2.IDKey(passphrase, salt, argon2Time, argon2Memory, argon2Threads, PSKSize))
+	default:
+		return psk, fmt.Errorf("unknown key derivation function %q", kdf)
+	}
+	return psk, nil
+}
@@ -0,0 +1,23 @@
+package psk
+
+import "testing"
+
+// Derived keys must never change, otherwise operators won't be able to
+// recreate existing keys from their passphrases.
+func TestDerivePSK(t *testing.T) {
+	for _, tc := range []struct {
+		kdf, expected string
+	}{
+		{KDFScrypt, "c2f915d805187d884f6d2391279fd18cd058e65d022f81c3d87f9cf66572201f"},
+		{KDFArgon2id, "bc3d8aacc1742ae24b35aa6d64e01eeac4b8a37d662276c5031f6399a19f4b3a"},
+	} {
+		key, err := DerivePSK(tc.kdf, []byte("correct horse"), []byte("rgap-1000"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.kdf, err)
+			continue
+		}
+		if key.String() != tc.expected {
+			t.Errorf("%s: derived key %s != %s", tc.kdf, key.String(), tc.expected)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/SenseUnit/rgap/util"
 )
 
 const (
@@ -43,6 +45,10 @@ func (psk *PSK) UnmarshalYAML(value *yaml.Node) error {
 	if err := value.Decode(&hexval); err != nil {
 		return fmt.Errorf("PSK unmarshaler unable to retrieve hex string from given node: %w", err)
 	}
+	hexval, err := util.ExpandString(hexval)
+	if err != nil {
+		return fmt.Errorf("line %d: PSK unmarshaler unable to expand value: %w", value.Line, err)
+	}
 	if err := psk.FromHexString(hexval); err != nil {
 		return fmt.Errorf("PSK unmarshaller can't set value from hex string: %w", err)
 	}
@@ -53,6 +59,14 @@ func (psk *PSK) MarshalYAML() (interface{}, error) {
 	return psk.AsHexString(), nil
 }
 
+func (psk *PSK) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "string",
+		// hex string or value with environment or file reference
+		"pattern": fmt.Sprintf(`^([0-9a-fA-F]{%d}|.*\$\{.*|file:.*)$`, 2*PSKSize),
+	}
+}
+
 func GeneratePSK() (PSK, error) {
 	var psk PSK
 	if _, err := rand.Read(psk.AsSlice()); err != nil {
@@ -0,0 +1,166 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+
+	"github.com/SenseUnit/rgap/agent"
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/iface"
+	"github.com/SenseUnit/rgap/listener"
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/util"
+)
+
+const (
+	defaultDedupWindow = 1 * time.Minute
+	defaultTimeout     = 5 * time.Second
+	queueSize          = 1024
+)
+
+type signature = [protocol.SignatureSize]byte
+
+type Relay struct {
+	sources      []iface.StartStopper
+	sender       *agent.Sender
+	destinations []string
+	groups       map[uint64]struct{}
+	dedupWindow  time.Duration
+	timeout      time.Duration
+	seen         *ttlcache.Cache[signature, struct{}]
+	queue        chan []byte
+	ctx          context.Context
+	ctxCancel    func()
+	loopDone     chan struct{}
+	logger       *slog.Logger
+}
+
+func NewRelay(cfg *config.RelayConfig, logger *slog.Logger) (*Relay, error) {
+	if len(cfg.Destinations) == 0 {
+		return nil, errors.New("no destinations specified")
+	}
+	r := &Relay{
+		sender:       agent.NewSender(nil),
+		destinations: util.PlainStrings(cfg.Destinations),
+		dedupWindow:  cfg.DedupWindow,
+		timeout:      cfg.Timeout,
+		logger:       logger,
+	}
+	if r.dedupWindow <= 0 {
+		r.dedupWindow = defaultDedupWindow
+	}
+	if r.timeout <= 0 {
+		r.timeout = defaultTimeout
+	}
+	if cfg.Groups != nil {
+		r.groups = make(map[uint64]struct{})
+		for _, gid := range cfg.Groups {
+			r.groups[gid] = struct{}{}
+		}
+	}
+	for _, address := range util.PlainStrings(cfg.Listen) {
+		r.sources = append(r.sources, listener.NewUDPSource(address, address, r.announceCallback, logger))
+	}
+	for i, sc := range cfg.Sources {
+		src, err := listener.SourceFromConfig(&sc, r.announceCallback, logger)
+		if err != nil {
+			return nil, sc.Pos.Errorf("unable to construct new source with index %d: %w", i, err)
+		}
+		r.sources = append(r.sources, src)
+	}
+	if len(r.sources) == 0 {
+		return nil, errors.New("no sources specified")
+	}
+	return r, nil
+}
+
+func (r *Relay) announceCallback(label, _ string, ann *protocol.Announcement) {
+	if r.groups != nil {
+		if _, ok := r.groups[ann.Data.RedundancyID]; !ok {
+			return
+		}
+	}
+	// Announcements are relayed verbatim, so there is no room for hop
+	// counters. Instead loops are broken by refusing to relay anything
+	// outside of the dedup window around current time and by remembering
+	// signatures of relayed messages for as long as they stay within it.
+	announceTime := time.UnixMicro(ann.Data.Timestamp)
+	if time.Since(announceTime).Abs() > r.dedupWindow {
+		return
+	}
+	ttl := time.Until(announceTime.Add(r.dedupWindow))
+	if ttl <= 0 {
+		return
+	}
+	if _, found := r.seen.GetOrSet(ann.Signature, struct{}{}, ttlcache.WithTTL[signature, struct{}](ttl)); found {
+		return
+	}
+	msg, err := ann.MarshalBinary()
+	if err != nil {
+		r.logger.Error("can't marshal announcement", "source", label, "err", err)
+		return
+	}
+	select {
+	case r.queue <- msg:
+	default:
+		r.logger.Warn("queue is full, dropping announcement", "source", label)
+	}
+}
+
+func (r *Relay) Run(ctx context.Context) error {
+	ctx1, cancel := context.WithCancel(context.Background())
+	r.ctx = ctx1
+	r.ctxCancel = cancel
+	r.queue = make(chan []byte, queueSize)
+	r.loopDone = make(chan struct{})
+	r.seen = ttlcache.New[signature, struct{}](
+		ttlcache.WithDisableTouchOnHit[signature, struct{}](),
+	)
+	go r.seen.Start()
+	defer r.seen.Stop()
+	go r.sendLoop()
+	defer func() {
+		r.ctxCancel()
+		<-r.loopDone
+	}()
+
+	var primeStack []iface.StartStopper
+	defer func() {
+		for i := len(primeStack) - 1; i >= 0; i-- {
+			if err := primeStack[i].Stop(); err != nil {
+				r.logger.Error("shutdown error", "err", err)
+			}
+		}
+	}()
+	for _, source := range r.sources {
+		if err := source.Start(); err != nil {
+			return fmt.Errorf("startup error: %w", err)
+		}
+		primeStack = append(primeStack, source)
+	}
+	r.logger.Info("relay is now operational")
+	<-ctx.Done()
+	r.logger.Info("relay is shutting down")
+	return nil
+}
+
+func (r *Relay) sendLoop() {
+	defer close(r.loopDone)
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case msg := <-r.queue:
+			sendCtx, cancel := context.WithTimeout(r.ctx, r.timeout)
+			if err := r.sender.Send(sendCtx, msg, r.destinations); err != nil {
+				r.logger.Error("send error", "err", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/SenseUnit/rgap/agent"
+	"github.com/SenseUnit/rgap/config"
+	"github.com/SenseUnit/rgap/protocol"
+	"github.com/SenseUnit/rgap/psk"
+	"github.com/SenseUnit/rgap/util"
+)
+
+func TestRelayDedup(t *testing.T) {
+	const window = 600 * time.Millisecond
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.sock")
+	dstPath := filepath.Join(dir, "dst.sock")
+	dst := util.Must(net.ListenUnixgram("unixgram", &net.UnixAddr{Name: dstPath, Net: "unixgram"}))
+	defer dst.Close()
+
+	var cfg config.RelayConfig
+	if err := yaml.Unmarshal([]byte(`
+sources:
+  - kind: unixgram
+    spec:
+      path: `+srcPath+`
+destinations:
+  - unix:`+dstPath+`
+only_groups: [1000]
+dedup_window: `+window.String()+`
+`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRelay(&cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	runDone := make(chan error)
+	go func() { runDone <- r.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-runDone; err != nil {
+			t.Error(err)
+		}
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(srcPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("relay source is not started")
+		}
+	}
+
+	key := util.Must(psk.GeneratePSK())
+	sender := agent.NewSender(nil)
+	send := func(group uint64, ts time.Time) *protocol.Announcement {
+		t.Helper()
+		ann := &protocol.Announcement{
+			Data: protocol.AnnouncementData{
+				Version:          protocol.V1,
+				RedundancyID:     group,
+				Timestamp:        ts.UnixMicro(),
+				AnnouncedAddress: netip.MustParseAddr("10.0.0.1").As16(),
+			},
+		}
+		ann.Signature = util.Must(ann.Data.CalculateSignature(key))
+		if err := sender.SendSingle(context.Background(), util.Must(ann.MarshalBinary()), "unix:"+srcPath); err != nil {
+			t.Fatal(err)
+		}
+		return ann
+	}
+	expect := func(step string, ann *protocol.Announcement) {
+		t.Helper()
+		buf := make([]byte, 4096)
+		dst.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := dst.Read(buf)
+		if ann == nil {
+			if err == nil {
+				t.Fatalf("%s: unexpected relayed message %x", step, buf[:n])
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		var got protocol.Announcement
+		if err := got.UnmarshalBinary(buf[:n]); err != nil {
+			t.Fatal(err)
+		}
+		if got != *ann {
+			t.Fatalf("%s: relayed %v, expected %v", step, got, *ann)
+		}
+	}
+
+	fresh := send(1000, time.Now())
+	expect("fresh announcement", fresh)
+	send(1000, time.UnixMicro(fresh.Data.Timestamp))
+	expect("duplicate", nil)
+	send(1001, time.Now())
+	expect("foreign group", nil)
+	send(1000, time.Now().Add(-2*window))
+	expect("stale announcement", nil)
+	send(1000, time.Now().Add(2*window))
+	expect("announcement from the future", nil)
+
+	// announcement stamped ahead of time stays within window for longer
+	// than dedup window since its first sight
+	future := send(1000, time.Now().Add(window*2/3))
+	expect("future announcement", future)
+	time.Sleep(window * 4 / 3)
+	send(1000, time.UnixMicro(future.Data.Timestamp))
+	expect("looped future announcement", nil)
+}
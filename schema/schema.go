@@ -0,0 +1,185 @@
+// Package schema derives JSON Schema documents from configuration types
+// following the same field naming rules as YAML decoder.
+package schema
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	Draft          = "http://json-schema.org/draft-07/schema#"
+	DurationRegexp = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+)
+
+type Schema = map[string]interface{}
+
+// Describer is implemented by types with custom YAML representation.
+// JSONSchema method must work on zero value.
+type Describer interface {
+	JSONSchema() map[string]interface{}
+}
+
+var (
+	describerType = reflect.TypeOf((*Describer)(nil)).Elem()
+	durationType  = reflect.TypeOf(time.Duration(0))
+	yamlNodeType  = reflect.TypeOf(yaml.Node{})
+)
+
+type Generator struct {
+	overrides map[reflect.Type]Schema
+}
+
+func NewGenerator() *Generator {
+	return &Generator{
+		overrides: make(map[reflect.Type]Schema),
+	}
+}
+
+// Override makes generator use given schema for all values of type t.
+func (g *Generator) Override(t reflect.Type, s Schema) {
+	g.overrides[t] = s
+}
+
+// Document returns top level schema for type t.
+func (g *Generator) Document(t reflect.Type, title string) Schema {
+	s := g.For(t)
+	s["$schema"] = Draft
+	s["title"] = title
+	return s
+}
+
+func (g *Generator) For(t reflect.Type) Schema {
+	if s, ok := g.overrides[t]; ok {
+		return copySchema(s)
+	}
+	if t.Implements(describerType) {
+		return reflect.Zero(t).Interface().(Describer).JSONSchema()
+	}
+	if reflect.PointerTo(t).Implements(describerType) {
+		return reflect.New(t).Interface().(Describer).JSONSchema()
+	}
+	switch t {
+	case durationType:
+		return Schema{"type": "string", "pattern": DurationRegexp}
+	case yamlNodeType:
+		return Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.For(t.Elem())
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Schema{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Schema{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": g.For(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.For(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+	return Schema{}
+}
+
+// Kinds returns schema of {kind, spec} dictionary where schema of spec
+// depends on value of kind. specs maps kind names to zero values of
+// corresponding spec types, nil values stand for kinds accepting any spec.
+func (g *Generator) Kinds(specs map[string]interface{}) Schema {
+	kinds := make([]string, 0, len(specs))
+	for kind := range specs {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	conditions := make([]interface{}, 0, len(kinds))
+	for _, kind := range kinds {
+		if specs[kind] == nil {
+			continue
+		}
+		conditions = append(conditions, Schema{
+			"if": Schema{
+				"properties": Schema{"kind": Schema{"const": kind}},
+				"required":   []string{"kind"},
+			},
+			"then": Schema{
+				"properties": Schema{
+					"spec": Schema{
+						"anyOf": []interface{}{
+							Schema{"type": "null"},
+							g.For(reflect.TypeOf(specs[kind])),
+						},
+					},
+				},
+			},
+		})
+	}
+	s := Schema{
+		"type": "object",
+		"properties": Schema{
+			"kind": Schema{"type": "string", "enum": kinds},
+			"spec": Schema{},
+		},
+		"required":             []string{"kind"},
+		"additionalProperties": false,
+	}
+	if len(conditions) > 0 {
+		s["allOf"] = conditions
+	}
+	return s
+}
+
+func (g *Generator) structSchema(t reflect.Type) Schema {
+	props := make(Schema)
+	g.collectFields(t, props)
+	return Schema{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+func (g *Generator) collectFields(t reflect.Type, props Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(","+opts+",", ",inline,") {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.collectFields(ft, props)
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		props[name] = g.For(f.Type)
+	}
+}
+
+func copySchema(s Schema) Schema {
+	res := make(Schema, len(s))
+	for k, v := range s {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,54 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SenseUnit/rgap/psk"
+)
+
+type testSpec struct {
+	BindAddress string `yaml:"bind_address"`
+	Interval    time.Duration
+	Key         *psk.PSK
+	Hidden      int `yaml:"-"`
+	Tags        []string
+	hidden      int
+}
+
+func TestStructSchema(t *testing.T) {
+	s := NewGenerator().For(reflect.TypeOf(testSpec{}))
+	if s["additionalProperties"] != false {
+		t.Error("struct schema must not allow unknown fields")
+	}
+	props := s["properties"].(Schema)
+	for _, name := range []string{"bind_address", "interval", "key", "tags"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("property %q is missing", name)
+		}
+	}
+	if len(props) != 4 {
+		t.Errorf("unexpected number of properties: %d != 4", len(props))
+	}
+	if props["interval"].(Schema)["pattern"] != DurationRegexp {
+		t.Error("duration field doesn't have duration pattern")
+	}
+	if props["key"].(Schema)["pattern"] != (*psk.PSK)(nil).JSONSchema()["pattern"] {
+		t.Error("PSK field doesn't use schema provided by PSK type")
+	}
+}
+
+func TestKinds(t *testing.T) {
+	s := NewGenerator().Kinds(map[string]interface{}{
+		"noop": nil,
+		"spec": testSpec{},
+	})
+	kinds := s["properties"].(Schema)["kind"].(Schema)["enum"].([]string)
+	if !reflect.DeepEqual(kinds, []string{"noop", "spec"}) {
+		t.Errorf("unexpected kinds: %v", kinds)
+	}
+	if conditions := s["allOf"].([]interface{}); len(conditions) != 1 {
+		t.Errorf("unexpected number of conditions: %d != 1", len(conditions))
+	}
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const fileRefPrefix = "file:"
+
+// ExpandString substitutes ${NAME} references with values of environment
+// variables. "$${" stands for literal "${". If resulting string starts with
+// "file:" prefix, it is replaced with contents of referenced file with
+// trailing newlines removed.
+func ExpandString(s string) (string, error) {
+	res, err := expandEnv(s)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(s, fileRefPrefix) {
+		filename := strings.TrimPrefix(res, fileRefPrefix)
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return "", fmt.Errorf("unable to read referenced file: %w", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return res, nil
+}
+
+// ExpandableString is a configuration string which may refer to
+// environment variables and files like PSKs do. References are resolved by
+// ExpandString when value is decoded, so every load of configuration picks
+// up current environment. Plain strings of configuration are used
+// literally.
+type ExpandableString string
+
+func (s *ExpandableString) UnmarshalYAML(value *yaml.Node) error {
+	res, err := expandNode(value, "value")
+	if err != nil {
+		return err
+	}
+	*s = ExpandableString(res)
+	return nil
+}
+
+// Secret is an ExpandableString holding sensitive value.
+type Secret string
+
+func (s *Secret) UnmarshalYAML(value *yaml.Node) error {
+	res, err := expandNode(value, "secret")
+	if err != nil {
+		return err
+	}
+	*s = Secret(res)
+	return nil
+}
+
+func expandNode(value *yaml.Node, what string) (string, error) {
+	var str string
+	if err := value.Decode(&str); err != nil {
+		return "", err
+	}
+	res, err := ExpandString(str)
+	if err != nil {
+		return "", fmt.Errorf("line %d: unable to expand %s: %w", value.Line, what, err)
+	}
+	return res, nil
+}
+
+// PlainStrings converts list of expanded configuration values into
+// plain strings.
+func PlainStrings(list []ExpandableString) []string {
+	res := make([]string, 0, len(list))
+	for _, s := range list {
+		res = append(res, string(s))
+	}
+	return res
+}
+
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for {
+		idx := strings.Index(s, "${")
+		if idx < 0 {
+			sb.WriteString(s)
+			break
+		}
+		if idx > 0 && s[idx-1] == '$' {
+			sb.WriteString(s[:idx-1])
+			sb.WriteString("${")
+			s = s[idx+2:]
+			continue
+		}
+		sb.WriteString(s[:idx])
+		name, rest, found := strings.Cut(s[idx+2:], "}")
+		if !found {
+			return "", fmt.Errorf("unterminated variable reference in %q", s[idx:])
+		}
+		if name == "" {
+			return "", fmt.Errorf("empty variable name in %q", s[idx:])
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", name)
+		}
+		sb.WriteString(value)
+		s = rest
+	}
+	return sb.String(), nil
+}
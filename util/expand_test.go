@@ -0,0 +1,70 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpandString(t *testing.T) {
+	t.Setenv("RGAP_TEST_VAR", "value")
+	filename := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(filename, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RGAP_TEST_FILE", filename)
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"plain", "plain"},
+		{"$HOME", "$HOME"},
+		{"${RGAP_TEST_VAR}", "value"},
+		{"a-${RGAP_TEST_VAR}-b", "a-value-b"},
+		{"$${RGAP_TEST_VAR}", "${RGAP_TEST_VAR}"},
+		{"file:" + filename, "secret"},
+		{"file:${RGAP_TEST_FILE}", "secret"},
+	} {
+		res, err := ExpandString(tc.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+			continue
+		}
+		if res != tc.out {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.out, res)
+		}
+	}
+	for _, in := range []string{"${RGAP_TEST_UNSET}", "${RGAP_TEST_VAR", "file:/nonexistent"} {
+		if _, err := ExpandString(in); err == nil {
+			t.Errorf("%q: error expected", in)
+		}
+	}
+}
+
+func TestSecretUnmarshal(t *testing.T) {
+	t.Setenv("RGAP_TEST_VAR", "value")
+	var cfg struct {
+		Secret  Secret   `yaml:"secret"`
+		Escaped Secret   `yaml:"escaped"`
+		Command []string `yaml:"command"`
+	}
+	doc := `
+secret: ${RGAP_TEST_VAR}
+escaped: $${RGAP_TEST_VAR}
+command: ["sh", "-c", "echo ${RGAP_TEST_VAR}", "file:/nonexistent"]
+`
+	if err := yaml.Unmarshal([]byte(doc), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Secret != "value" || cfg.Escaped != "${RGAP_TEST_VAR}" {
+		t.Errorf("secrets expanded to %q and %q", cfg.Secret, cfg.Escaped)
+	}
+	// plain strings are left intact
+	if cfg.Command[2] != "echo ${RGAP_TEST_VAR}" || cfg.Command[3] != "file:/nonexistent" {
+		t.Errorf("plain strings are expanded: %q", cfg.Command)
+	}
+	if err := yaml.Unmarshal([]byte("secret: ${RGAP_TEST_UNSET}"), &cfg); err == nil {
+		t.Error("unset variable accepted")
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/netip"
+	"strconv"
 	"strings"
 
 	"golang.org/x/exp/constraints"
@@ -40,6 +41,56 @@ func (a *IPAddr) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+func (a *IPAddr) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "string",
+		"anyOf": []interface{}{
+			map[string]interface{}{"format": "ipv4"},
+			map[string]interface{}{"format": "ipv6"},
+		},
+	}
+}
+
+// IPPrefix is a network prefix. Plain address is accepted as well and
+// treated as a single host prefix.
+type IPPrefix netip.Prefix
+
+func (p *IPPrefix) Prefix() netip.Prefix {
+	return netip.Prefix(*p)
+}
+
+func (p *IPPrefix) String() string {
+	return (*netip.Prefix)(p).String()
+}
+
+func (p *IPPrefix) MarshalYAML() (interface{}, error) {
+	return p.String(), nil
+}
+
+func (p *IPPrefix) UnmarshalYAML(value *yaml.Node) error {
+	var decodedVal string
+	if err := value.Decode(&decodedVal); err != nil {
+		return err
+	}
+	if addr, err := netip.ParseAddr(decodedVal); err == nil {
+		*p = IPPrefix(netip.PrefixFrom(addr, addr.BitLen()))
+		return nil
+	}
+	parsedPrefix, err := netip.ParsePrefix(decodedVal)
+	if err != nil {
+		return err
+	}
+	*p = IPPrefix(parsedPrefix.Masked())
+	return nil
+}
+
+func (p *IPPrefix) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "string",
+		"pattern": `^[0-9a-fA-F.:]+(/[0-9]+)?$`,
+	}
+}
+
 func Must[V any](value V, err error) V {
 	if err != nil {
 		panic(err)
@@ -50,20 +101,85 @@ func Must[V any](value V, err error) V {
 func CheckedUnmarshal(doc *yaml.Node, dst interface{}) error {
 	var buf bytes.Buffer
 	enc := yaml.NewEncoder(&buf)
-	if err := enc.Encode(doc); err != nil {
+	// block style puts every entry on its own line, so decoding error
+	// lines can be matched back to original nodes
+	if err := enc.Encode(blockStyle(doc)); err != nil {
 		return fmt.Errorf("unable to re-marshal node: %w", err)
 	}
 	if err := enc.Close(); err != nil {
 		return fmt.Errorf("unable to re-marshal node: close failed: %w", err)
 	}
-	dec := yaml.NewDecoder(&buf)
+	remarshaled := buf.Bytes()
+	dec := yaml.NewDecoder(bytes.NewReader(remarshaled))
 	dec.KnownFields(true) // that's whole point of such marshaling round trip
 	if err := dec.Decode(dst); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) && doc.Line > 0 {
+			// errors refer to lines of re-marshaled node, which may
+			// differ in layout. Translate them back to lines of
+			// original document by matching nodes of both trees.
+			var root yaml.Node
+			if yaml.Unmarshal(remarshaled, &root) == nil && len(root.Content) > 0 {
+				lines := make(map[int]int)
+				if doc.Kind == yaml.DocumentNode {
+					matchLines(doc, &root, lines)
+				} else {
+					matchLines(doc, root.Content[0], lines)
+				}
+				for i, msg := range typeErr.Errors {
+					typeErr.Errors[i] = translateErrorLine(msg, lines)
+				}
+			}
+		}
 		return fmt.Errorf("unable to unmarshal node: %w", err)
 	}
 	return nil
 }
 
+func blockStyle(n *yaml.Node) *yaml.Node {
+	res := *n
+	res.Style &^= yaml.FlowStyle
+	res.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		res.Content[i] = blockStyle(child)
+	}
+	return &res
+}
+
+// matchLines walks original and re-marshaled node trees in parallel and
+// records line of original node for each line of re-marshaled one.
+func matchLines(orig, remarshaled *yaml.Node, lines map[int]int) {
+	if orig.Kind != remarshaled.Kind || len(orig.Content) != len(remarshaled.Content) {
+		return
+	}
+	if _, ok := lines[remarshaled.Line]; !ok {
+		lines[remarshaled.Line] = orig.Line
+	}
+	for i := range orig.Content {
+		matchLines(orig.Content[i], remarshaled.Content[i], lines)
+	}
+}
+
+func translateErrorLine(msg string, lines map[int]int) string {
+	rest, ok := strings.CutPrefix(msg, "line ")
+	if !ok {
+		return msg
+	}
+	num, rest, ok := strings.Cut(rest, ":")
+	if !ok {
+		return msg
+	}
+	line, err := strconv.Atoi(num)
+	if err != nil {
+		return msg
+	}
+	orig, ok := lines[line]
+	if !ok {
+		return msg
+	}
+	return fmt.Sprintf("line %d:%s", orig, rest)
+}
+
 func SplitAndResolveAddrSpec(spec string) (string, *net.Interface, error) {
 	addrSpec, ifaceSpec, found := strings.Cut(spec, "@")
 	if !found {
@@ -88,7 +204,7 @@ func ResolveInterface(spec string) (*net.Interface, error) {
 			if err != nil {
 				// may be a problem with some interface,
 				// but we still probably can find the right one
-				log.Printf("WARNING: interface %s is failing to report its addresses: %v", ifaces[i].Name, err)
+				slog.Warn("interface is failing to report its addresses", "interface", ifaces[i].Name, "err", err)
 				continue
 			}
 			for _, addr := range addrs {
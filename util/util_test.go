@@ -0,0 +1,65 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckedUnmarshalErrorLine(t *testing.T) {
+	type spec struct {
+		Interval time.Duration `yaml:"interval"`
+		Command  []string      `yaml:"command"`
+		Timeout  time.Duration `yaml:"timeout"`
+	}
+	var cfg struct {
+		Kind string    `yaml:"kind"`
+		Spec yaml.Node `yaml:"spec"`
+	}
+	for _, tc := range []struct {
+		name string
+		doc  string
+		line string
+	}{
+		{"bad value", `
+kind: command
+
+spec:
+  # blank lines and comments are not preserved at same lines
+  interval: 1m
+
+
+  command:
+    - "/bin/true"
+
+    - "arg"
+
+  timeout: never
+`, "line 14:"},
+		{"unknown field", `
+kind: command
+spec: {interval: 1m,
+  command: [
+    /bin/true,
+    arg],
+
+  retries: 3}
+`, "line 8:"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := yaml.Unmarshal([]byte(tc.doc), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			var s spec
+			err := CheckedUnmarshal(&cfg.Spec, &s)
+			if err == nil {
+				t.Fatal("bad spec accepted")
+			}
+			if !strings.Contains(err.Error(), tc.line) {
+				t.Errorf("error %q does not refer to %s", err, strings.TrimSuffix(tc.line, ":"))
+			}
+		})
+	}
+}